@@ -1,6 +1,7 @@
 package autofs
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path"
@@ -15,10 +16,10 @@ import (
 	"textmodes.com/vfs/zipfs"
 )
 
-// Common errors.
+// Common errors, these are the same as their vfs counterparts.
 var (
-	ErrNotSupported = errors.New("autofs: not supported")
-	ErrDir          = errors.New("autofs: is a directory")
+	ErrNotSupported = vfs.ErrNotSupported
+	ErrDir          = vfs.ErrIsDir
 
 	hasFileSystem = map[string]bool{
 		".rar": true,
@@ -43,9 +44,14 @@ func New(root string) (vfs.FileSystem, error) {
 
 	var (
 		fs = &fileSystem{
-			Scope:        vfs.NewScope(),
+			SyncScope:    vfs.NewSyncScope(),
 			overlay:      make(map[string]vfs.FileSystem),
+			failed:       make(map[string]*mountFailure),
+			mounting:     make(map[string]*mountCall),
 			overlayMutex: new(sync.Mutex),
+			tracerMutex:  new(sync.RWMutex),
+			tracer:       new(vfs.Tracer),
+			wrap:         new(func(string, vfs.FileSystem) vfs.FileSystem),
 		}
 		base vfs.FileSystem
 	)
@@ -53,7 +59,7 @@ func New(root string) (vfs.FileSystem, error) {
 		fs.Bind("/", "/", vfs.OS(root), vfs.BindReplace)
 	} else {
 		fs.Bind("/", "/", vfs.OS(path.Dir(root)), vfs.BindReplace)
-		if base, err = fs.openFileSystem(path.Base(root)); err != nil {
+		if base, err = fs.openFileSystem(context.Background(), path.Base(root)); err != nil {
 			return nil, err
 		}
 		fs.Bind("/", "/", base, vfs.BindReplace)
@@ -63,90 +69,253 @@ func New(root string) (vfs.FileSystem, error) {
 }
 
 type fileSystem struct {
-	vfs.Scope
+	*vfs.SyncScope
 	overlay      map[string]vfs.FileSystem
+	failed       map[string]*mountFailure
+	mounting     map[string]*mountCall
 	overlayMutex *sync.Mutex
+	tracerMutex  *sync.RWMutex // guards tracer
+	tracer       *vfs.Tracer
+	wrap         *func(name string, fs vfs.FileSystem) vfs.FileSystem
 }
 
-func (fs fileSystem) openFileSystem(name string) (vfs.FileSystem, error) {
-	info, err := fs.Scope.Stat(name)
+// Tracer returns the Tracer set with SetTracer.
+func (fs fileSystem) Tracer() vfs.Tracer {
+	fs.tracerMutex.RLock()
+	defer fs.tracerMutex.RUnlock()
+	return *fs.tracer
+}
+
+// SetTracer sets the Tracer for fs and all archives mounted in it.
+func (fs fileSystem) SetTracer(t vfs.Tracer) {
+	fs.overlayMutex.Lock()
+	defer fs.overlayMutex.Unlock()
+
+	fs.tracerMutex.Lock()
+	*fs.tracer = t
+	fs.tracerMutex.Unlock()
+	for _, overlay := range fs.overlay {
+		vfs.SetTracer(overlay, t)
+	}
+}
+
+// WrapOverlays calls wrap for all archives mounted in fs so far and from now
+// on, and uses the result in their place.
+func (fs fileSystem) WrapOverlays(wrap func(name string, fs vfs.FileSystem) vfs.FileSystem) {
+	fs.overlayMutex.Lock()
+	defer fs.overlayMutex.Unlock()
+
+	for name, overlay := range fs.overlay {
+		fs.overlay[name] = wrap(name, overlay)
+	}
+	if prev := *fs.wrap; prev != nil {
+		*fs.wrap = func(name string, overlay vfs.FileSystem) vfs.FileSystem {
+			return wrap(name, prev(name, overlay))
+		}
+	} else {
+		*fs.wrap = wrap
+	}
+}
+
+func (fs fileSystem) openFileSystem(ctx context.Context, name string) (vfs.FileSystem, error) {
+	info, err := fs.SyncScope.StatContext(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 	if info.IsDir() {
-		return nil, ErrDir
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrDir}
 	}
 
 	switch ext := strings.ToLower(filepath.Ext(info.Name())); ext {
 	case ".rar":
-		return rarfs.OpenFile(fs.Scope, name)
+		return rarfs.OpenFileContext(ctx, fs.SyncScope, name)
 	case ".tar":
-		return tarfs.OpenFile(fs.Scope, name)
+		return tarfs.OpenFileContext(ctx, fs.SyncScope, name)
 	case ".zip":
-		return zipfs.OpenFile(fs.Scope, name)
+		return zipfs.OpenFileContext(ctx, fs.SyncScope, name)
 	default:
-		return nil, ErrNotSupported
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrNotSupported}
 	}
 }
 
 func (fs fileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs fileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
 	name = fs.clean(name)
 
-	dir, base := name, "/"
-	for {
-		if overlay, ok := fs.overlay[dir]; ok {
-			return overlay.Readdir(base)
-		}
-		if i := strings.LastIndexByte(dir, '/'); i > -1 {
-			dir, base = dir[:i], dir[i:]
-		} else {
-			break
-		}
+	if overlay, base, ok := fs.resolve(ctx, name); ok {
+		infos, err := vfs.ReaddirContext(ctx, overlay, base)
+		return infos, withPath(err, name)
 	}
 
-	infos, err := fs.Scope.Readdir(name)
+	infos, err := fs.SyncScope.ReaddirContext(ctx, name)
 	if err != nil {
 		return nil, err
 	}
 
-	fs.overlayMutex.Lock()
-	defer fs.overlayMutex.Unlock()
-
-probing:
 	for i, info := range infos {
 		full := path.Join(name, path.Base(info.Name()))
-		if _, ok := fs.overlay[full]; ok {
-			infos[i] = dirInfo{
-				name:    info.Name(),
-				size:    info.Size(),
-				modTime: info.ModTime(),
-			}
-		} else if hasFileSystem[strings.ToLower(filepath.Ext(full))] {
-			vfs.Tracef(fs, "Readdir(%q): mounting %q", name, full)
-			if fs.overlay[full], err = fs.openFileSystem(full); err != nil {
-				if err == vfs.ErrNotSupported {
-					delete(fs.overlay, full)
-					continue probing
-				}
-				return nil, err
-			}
-			infos[i] = dirInfo{
-				name:    info.Name(),
-				size:    info.Size(),
-				modTime: info.ModTime(),
+		if !hasFileSystem[strings.ToLower(filepath.Ext(full))] {
+			continue
+		}
+		if _, err = fs.mount(ctx, full); err != nil {
+			if unmountable(err) {
+				continue // presented as a regular file
 			}
+			return nil, err
+		}
+		infos[i] = dirInfo{
+			name:    info.Name(),
+			size:    info.Size(),
+			modTime: info.ModTime(),
 		}
 	}
 
 	return infos, nil
 }
 
+// mountFailure is a failed mount of an archive.
+type mountFailure struct {
+	err      error
+	failures int
+	retry    time.Time
+}
+
+// mountCall is a mount of an archive in progress, shared by all callers
+// waiting for it. The archive is read until the last caller stops waiting.
+type mountCall struct {
+	done    chan struct{}
+	overlay vfs.FileSystem
+	err     error
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// mount returns the overlay for the archive at name, opening it if it hasn't
+// been mounted yet. Concurrent callers share one mount, and other archives
+// can be mounted meanwhile. Failures are cached, and the archive isn't opened
+// again until a backoff expires, like the constructors of vfs.BindFunc.
+func (fs fileSystem) mount(ctx context.Context, name string) (vfs.FileSystem, error) {
+	fs.overlayMutex.Lock()
+	if overlay, ok := fs.overlay[name]; ok {
+		fs.overlayMutex.Unlock()
+		return overlay, nil
+	}
+	if failure := fs.failed[name]; failure != nil && time.Now().Before(failure.retry) {
+		fs.overlayMutex.Unlock()
+		return nil, failure.err
+	}
+	call := fs.mounting[name]
+	if call == nil || call.waiters == 0 {
+		// Not mounting, or the mount is canceled.
+		mountCtx, cancel := context.WithCancel(context.Background())
+		call = &mountCall{done: make(chan struct{}), cancel: cancel}
+		fs.mounting[name] = call
+		go fs.doMount(mountCtx, name, call)
+	}
+	call.waiters++
+	fs.overlayMutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.overlay, call.err
+	case <-ctx.Done():
+		fs.overlayMutex.Lock()
+		if call.waiters--; call.waiters == 0 {
+			call.cancel()
+		}
+		fs.overlayMutex.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// doMount opens the archive at name for call, and records the result.
+func (fs fileSystem) doMount(ctx context.Context, name string, call *mountCall) {
+	defer call.cancel()
+
+	vfs.Tracef(fs, "mounting %q", name)
+	overlay, err := fs.openFileSystem(ctx, name)
+
+	fs.overlayMutex.Lock()
+	defer fs.overlayMutex.Unlock()
+
+	if fs.mounting[name] == call {
+		delete(fs.mounting, name)
+	}
+	switch {
+	case err == nil:
+		delete(fs.failed, name)
+		if t := fs.Tracer(); t != nil {
+			vfs.SetTracer(overlay, t)
+		}
+		if wrap := *fs.wrap; wrap != nil {
+			overlay = wrap(name, overlay)
+		}
+		fs.overlay[name] = overlay
+	case os.IsNotExist(err) || ctx.Err() != nil:
+		// Files may still appear, and canceled mounts may be retried.
+	default:
+		failure := fs.failed[name]
+		if failure == nil {
+			failure = new(mountFailure)
+			fs.failed[name] = failure
+		}
+		backoff := vfs.BindFuncMinRetry << uint(failure.failures)
+		if backoff > vfs.BindFuncMaxRetry || backoff <= 0 {
+			backoff = vfs.BindFuncMaxRetry
+		}
+		failure.err, failure.retry = err, time.Now().Add(backoff)
+		failure.failures++
+	}
+	call.overlay, call.err = overlay, err
+	close(call.done)
+}
+
+// resolve returns the overlay containing name, and the path of name within
+// that overlay. Archives along the path are mounted as needed.
+func (fs fileSystem) resolve(ctx context.Context, name string) (vfs.FileSystem, string, bool) {
+	var (
+		elems = strings.Split(strings.TrimPrefix(name, "/"), "/")
+		dir   = ""
+	)
+	for i, elem := range elems {
+		dir += "/" + elem
+		if !hasFileSystem[strings.ToLower(filepath.Ext(elem))] {
+			continue
+		}
+		if overlay, err := fs.mount(ctx, dir); err == nil {
+			return overlay, "/" + strings.Join(elems[i+1:], "/"), true
+		}
+	}
+	return nil, "", false
+}
+
+// unmountable reports whether err indicates that an archive can't be mounted,
+// as opposed to a failure reading it.
+func unmountable(err error) bool {
+	return errors.Is(err, vfs.ErrNotSupported) ||
+		errors.Is(err, vfs.ErrCorrupt) ||
+		errors.Is(err, vfs.ErrEncrypted) ||
+		errors.Is(err, vfs.ErrPasswordRequired)
+}
+
+// withPath returns err with the path of its *os.PathError replaced by name,
+// for errors of the overlays, which report paths relative to the archive.
+func withPath(err error, name string) error {
+	if err, ok := err.(*os.PathError); ok && err.Path != name {
+		return &os.PathError{Op: err.Op, Path: name, Err: err.Err}
+	}
+	return err
+}
+
 func (fs fileSystem) clean(name string) string {
 	return path.Clean("/" + name)
 }
 
 func (fs fileSystem) stat(name string, stat func(string) (os.FileInfo, error)) (os.FileInfo, error) {
-	info, err := fs.Scope.Stat(name)
+	info, err := stat(name)
 	if err != nil {
 		return nil, err
 	}
@@ -165,41 +334,71 @@ func (fs fileSystem) stat(name string, stat func(string) (os.FileInfo, error)) (
 func (fs fileSystem) Lstat(name string) (os.FileInfo, error) {
 	name = fs.clean(name)
 	vfs.Tracef(fs, "Lstat(%q)", name)
-	if _, ok := fs.overlay[name]; ok {
-		return dirInfo{name: name}, nil
-	}
-	dir, base := name, "/"
-	for {
-		if overlay, ok := fs.overlay[dir]; ok {
-			return overlay.Lstat(base)
-		}
-		if i := strings.LastIndexByte(dir, '/'); i > -1 {
-			dir, base = dir[:i], dir[i:]
-		} else {
-			break
+	if overlay, base, ok := fs.resolve(context.Background(), name); ok {
+		if base == "/" {
+			return fs.stat(name, fs.SyncScope.Lstat)
 		}
+		info, err := overlay.Lstat(base)
+		return info, withPath(err, name)
 	}
-	return fs.stat(name, fs.Scope.Lstat)
+	return fs.stat(name, fs.SyncScope.Lstat)
 }
 
 func (fs fileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.StatContext(context.Background(), name)
+}
+
+func (fs fileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
 	name = fs.clean(name)
 	vfs.Tracef(fs, "Stat(%q)", name)
-	if _, ok := fs.overlay[name]; ok {
-		return dirInfo{name: name}, nil
+	stat := func(name string) (os.FileInfo, error) {
+		return fs.SyncScope.StatContext(ctx, name)
 	}
-	dir, base := name, "/"
-	for {
-		if overlay, ok := fs.overlay[dir]; ok {
-			return overlay.Stat(base)
+	if overlay, base, ok := fs.resolve(ctx, name); ok {
+		if base == "/" {
+			return fs.stat(name, stat)
 		}
-		if i := strings.LastIndexByte(dir, '/'); i > -1 {
-			dir, base = dir[:i], dir[i:]
-		} else {
-			break
+		info, err := vfs.StatContext(ctx, overlay, base)
+		return info, withPath(err, name)
+	}
+	return fs.stat(name, stat)
+}
+
+func (fs fileSystem) Open(name string) (vfs.ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs fileSystem) OpenContext(ctx context.Context, name string) (vfs.ReadSeekCloser, error) {
+	name = fs.clean(name)
+	vfs.Tracef(fs, "Open(%q)", name)
+	if overlay, base, ok := fs.resolve(ctx, name); ok {
+		r, err := vfs.OpenContext(ctx, overlay, base)
+		return r, withPath(err, name)
+	}
+	return fs.SyncScope.OpenContext(ctx, name)
+}
+
+func (fs fileSystem) Readlink(name string) (string, error) {
+	name = fs.clean(name)
+	vfs.Tracef(fs, "Readlink(%q)", name)
+	if overlay, base, ok := fs.resolve(context.Background(), name); ok && base != "/" {
+		target, err := vfs.Readlink(overlay, base)
+		return target, withPath(err, name)
+	}
+	return fs.SyncScope.Readlink(name)
+}
+
+// Locate implements the vfs.MountFileSystem Locate method. Paths in mounted
+// archives are located in the archive.
+func (fs fileSystem) Locate(name string) (vfs.FileSystem, string, bool) {
+	name = fs.clean(name)
+	if overlay, base, ok := fs.resolve(context.Background(), name); ok {
+		if _, err := overlay.Lstat(base); err != nil {
+			return nil, "", false
 		}
+		return overlay, base, true
 	}
-	return fs.stat(name, fs.Scope.Stat)
+	return fs.SyncScope.Locate(name)
 }
 
 // dirInfo is a trivial implementation of os.FileInfo for a directory.
@@ -215,3 +414,11 @@ func (d dirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
 func (d dirInfo) ModTime() time.Time { return d.modTime }
 func (d dirInfo) IsDir() bool        { return true }
 func (d dirInfo) Sys() interface{}   { return nil }
+
+var (
+	_ vfs.ContextFileSystem  = fileSystem{}
+	_ vfs.MountFileSystem    = fileSystem{}
+	_ vfs.OverlayFileSystem  = fileSystem{}
+	_ vfs.ReadlinkFileSystem = fileSystem{}
+	_ vfs.TracerFileSystem   = fileSystem{}
+)
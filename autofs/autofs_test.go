@@ -0,0 +1,131 @@
+package autofs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"textmodes.com/vfs"
+)
+
+// mountCounter is a Tracer counting the archives mounted.
+type mountCounter struct {
+	mu     sync.Mutex
+	mounts map[string]int
+}
+
+func (c *mountCounter) Tracef(fs vfs.FileSystem, format string, v ...interface{}) {
+	if msg := fmt.Sprintf(format, v...); strings.HasPrefix(msg, "mounting ") {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.mounts[strings.TrimPrefix(msg, "mounting ")]++
+	}
+}
+
+func (c *mountCounter) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mounts[fmt.Sprintf("%q", name)]
+}
+
+func tempTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "autofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMountFailureCached(t *testing.T) {
+	dir := tempTree(t, map[string]string{"bad.zip": "not a zip file"})
+	defer os.RemoveAll(dir)
+
+	fs, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &mountCounter{mounts: make(map[string]int)}
+	vfs.SetTracer(fs, c)
+
+	for i := 0; i < 3; i++ {
+		if _, err = fs.Stat("/bad.zip/file"); err == nil {
+			t.Fatal("expected Stat in a corrupt archive to fail")
+		}
+	}
+	if n := c.count("/bad.zip"); n != 1 {
+		t.Errorf("expected 1 mount, got %d", n)
+	}
+}
+
+func TestMountShared(t *testing.T) {
+	fs, err := New("../testdata/zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &mountCounter{mounts: make(map[string]int)}
+	vfs.SetTracer(fs, c)
+
+	// A canceled caller doesn't fail the mount for the others.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = vfs.StatContext(ctx, fs, "/test.zip/test.txt"); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, name := range []string{"/test.zip/test.txt", "/unix.zip/hello"} {
+				if _, err := fs.Stat(name); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := c.count("/test.zip"); n > 2 {
+		t.Errorf("expected at most 2 mounts of /test.zip, got %d", n)
+	}
+	if n := c.count("/unix.zip"); n != 1 {
+		t.Errorf("expected 1 mount of /unix.zip, got %d", n)
+	}
+}
+
+func TestSetTracerConcurrent(t *testing.T) {
+	fs, err := New("../testdata/zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tracers of mounted archives may be changed while they are in use.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := fs.Stat("/test.zip/test.txt"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		vfs.SetTracer(fs, &mountCounter{mounts: make(map[string]int)})
+	}
+	wg.Wait()
+}
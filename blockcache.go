@@ -0,0 +1,388 @@
+package vfs
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// Defaults for ContentCacheOptions.
+const (
+	DefaultBlockSize = 64 << 10
+	DefaultMaxMemory = 64 << 20
+)
+
+// ContentCacheOptions configure CacheContent.
+type ContentCacheOptions struct {
+	// BlockSize is the size of the cached blocks. If zero,
+	// DefaultBlockSize is used.
+	BlockSize int64
+
+	// MaxMemory is the maximum number of bytes cached in memory. If zero,
+	// DefaultMaxMemory is used.
+	MaxMemory int64
+
+	// Dir is a directory blocks are written to when they are evicted from
+	// memory. If empty, evicted blocks are discarded. Each FileSystem
+	// returned by CacheContent writes to a new subdirectory of Dir, which
+	// isn't removed; Dir should be removed when the caches are no longer
+	// used.
+	Dir string
+
+	// MaxDisk is the maximum number of bytes cached on disk. If zero, the
+	// size of the cache on disk is not limited.
+	MaxDisk int64
+}
+
+// CacheContent returns a FileSystem that caches the contents of files opened
+// on fs in blocks, so files in compressed archives don't have to be decoded
+// again when they are opened or seeked repeatedly. Blocks are keyed by
+// fs.String(), the path and the modification time of the file, and are kept
+// in memory, least recently used first, optionally spilling to disk. Files
+// without a modification time are not cached, since changes to them can't be
+// detected.
+//
+// Files opened through the returned FileSystem support random Seek. Files
+// are opened on fs when they are opened, unless their first block is cached,
+// and later to read blocks that aren't cached.
+func CacheContent(fs FileSystem, opts ContentCacheOptions) FileSystem {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.MaxMemory <= 0 {
+		opts.MaxMemory = DefaultMaxMemory
+	}
+	if opts.Dir != "" {
+		dir, err := ioutil.TempDir(opts.Dir, "blocks")
+		if err != nil {
+			Tracef(fs, "CacheContent: %v", err)
+		}
+		opts.Dir = dir
+	}
+	return &contentCacheFileSystem{
+		fs: fs,
+		cache: &blockCache{
+			fs:     fs,
+			opts:   opts,
+			memory: newBlockLRU(),
+			disk:   newBlockLRU(),
+		},
+	}
+}
+
+type contentCacheFileSystem struct {
+	fs    FileSystem
+	cache *blockCache
+}
+
+func (fs *contentCacheFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *contentCacheFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	info, err := StatContext(ctx, fs.fs, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrIsDir}
+	}
+	if info.ModTime().IsZero() {
+		return OpenContext(ctx, fs.fs, name)
+	}
+	f := &cachedFile{
+		ctx:   ctx,
+		fs:    fs,
+		name:  name,
+		key:   fmt.Sprintf("%s\x00%s\x00%d", fs.fs.String(), path.Clean("/"+name), info.ModTime().UnixNano()),
+		size:  info.Size(),
+		cache: fs.cache,
+	}
+	// Report errors opening the file now rather than on Read; a cached
+	// first block means it was opened before.
+	if _, ok := f.cache.get(f.blockKey(0)); !ok {
+		if f.src, err = OpenContext(ctx, fs.fs, name); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (fs *contentCacheFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return fs.fs.Lstat(name)
+}
+
+func (fs *contentCacheFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.fs.Stat(name)
+}
+
+func (fs *contentCacheFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	return StatContext(ctx, fs.fs, name)
+}
+
+func (fs *contentCacheFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.fs.Readdir(name)
+}
+
+func (fs *contentCacheFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	return ReaddirContext(ctx, fs.fs, name)
+}
+
+func (fs *contentCacheFileSystem) Readlink(name string) (string, error) {
+	return Readlink(fs.fs, name)
+}
+
+func (fs *contentCacheFileSystem) String() string {
+	return fs.fs.String()
+}
+
+// cachedFile is a file read through the block cache. The underlying file is
+// opened with it, unless its first block is cached, and otherwise when a
+// block isn't cached.
+type cachedFile struct {
+	ctx    context.Context
+	fs     *contentCacheFileSystem
+	name   string
+	key    string
+	size   int64
+	offset int64
+	cache  *blockCache
+
+	src    ReadSeekCloser // nil until a block is missing if the first one is cached
+	srcOff int64
+}
+
+func (f *cachedFile) Read(p []byte) (n int, err error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	for n < len(p) && f.offset < f.size {
+		index := f.offset / f.cache.opts.BlockSize
+		block, err := f.block(index)
+		if err != nil {
+			return n, err
+		}
+		off := f.offset - index*f.cache.opts.BlockSize
+		if off >= int64(len(block)) {
+			// The file is shorter than reported.
+			f.size = f.offset
+			break
+		}
+		m := copy(p[n:], block[off:])
+		n += m
+		f.offset += int64(m)
+	}
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the block at index, reading it from the underlying file if
+// it isn't cached.
+func (f *cachedFile) block(index int64) ([]byte, error) {
+	key := f.blockKey(index)
+	if block, ok := f.cache.get(key); ok {
+		return block, nil
+	}
+
+	if f.src == nil {
+		src, err := OpenContext(f.ctx, f.fs.fs, f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.src = src
+	}
+	start := index * f.cache.opts.BlockSize
+	if start != f.srcOff {
+		if _, err := f.src.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		f.srcOff = start
+	}
+
+	block := make([]byte, f.cache.opts.BlockSize)
+	n, err := io.ReadFull(f.src, block)
+	f.srcOff += int64(n)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	block = block[:n]
+	f.cache.put(key, block)
+	return block, nil
+}
+
+// blockKey returns the cache key of the block at index.
+func (f *cachedFile) blockKey(index int64) string {
+	return fmt.Sprintf("%s\x00%d", f.key, index)
+}
+
+func (f *cachedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *cachedFile) Close() error {
+	if f.src == nil {
+		return nil
+	}
+	err := f.src.Close()
+	f.src = nil
+	return err
+}
+
+// blockCache is a two level LRU cache of blocks, in memory and on disk. The
+// lists are guarded by mu, the files on disk are read and written without
+// holding it.
+type blockCache struct {
+	fs   FileSystem // for tracing
+	opts ContentCacheOptions
+
+	mu     sync.Mutex
+	memory *blockLRU
+	disk   *blockLRU
+}
+
+func (c *blockCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	if block, ok := c.memory.get(key); ok {
+		c.mu.Unlock()
+		return block.([]byte), true
+	}
+	name, ok := c.disk.get(key)
+	if ok {
+		c.disk.remove(key)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	// Move the block back into memory.
+	block, err := ioutil.ReadFile(name.(string))
+	os.Remove(name.(string))
+	if err != nil {
+		return nil, false
+	}
+	c.put(key, block)
+	return block, true
+}
+
+func (c *blockCache) put(key string, block []byte) {
+	var evicted []blockEntry
+	c.mu.Lock()
+	c.memory.put(key, block, int64(len(block)))
+	for c.memory.size > c.opts.MaxMemory {
+		key, value := c.memory.evict()
+		if c.opts.Dir != "" {
+			evicted = append(evicted, blockEntry{key, value, 0})
+		}
+	}
+	c.mu.Unlock()
+
+	for _, e := range evicted {
+		c.putDisk(e.key, e.value.([]byte))
+	}
+}
+
+func (c *blockCache) putDisk(key string, block []byte) {
+	name := c.diskName(key)
+	if err := ioutil.WriteFile(name, block, 0600); err != nil {
+		Tracef(c.fs, "CacheContent: %v", err)
+		return
+	}
+
+	var removed []string
+	c.mu.Lock()
+	c.disk.put(key, name, int64(len(block)))
+	for c.opts.MaxDisk > 0 && c.disk.size > c.opts.MaxDisk {
+		_, name := c.disk.evict()
+		removed = append(removed, name.(string))
+	}
+	c.mu.Unlock()
+
+	for _, name := range removed {
+		os.Remove(name)
+	}
+}
+
+// diskName returns the name of the file caching the block with key.
+func (c *blockCache) diskName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.opts.Dir, hex.EncodeToString(sum[:]))
+}
+
+// blockLRU is a least recently used list of values with a size.
+type blockLRU struct {
+	list    *list.List
+	entries map[string]*list.Element
+	size    int64
+}
+
+type blockEntry struct {
+	key   string
+	value interface{}
+	size  int64
+}
+
+func newBlockLRU() *blockLRU {
+	return &blockLRU{
+		list:    list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (l *blockLRU) get(key string) (interface{}, bool) {
+	e, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	l.list.MoveToFront(e)
+	return e.Value.(*blockEntry).value, true
+}
+
+func (l *blockLRU) put(key string, value interface{}, size int64) {
+	l.remove(key)
+	l.entries[key] = l.list.PushFront(&blockEntry{key, value, size})
+	l.size += size
+}
+
+func (l *blockLRU) remove(key string) {
+	if e, ok := l.entries[key]; ok {
+		l.list.Remove(e)
+		delete(l.entries, key)
+		l.size -= e.Value.(*blockEntry).size
+	}
+}
+
+// evict removes and returns the least recently used value.
+func (l *blockLRU) evict() (string, interface{}) {
+	entry := l.list.Back().Value.(*blockEntry)
+	l.remove(entry.key)
+	return entry.key, entry.value
+}
+
+var (
+	_ ContextFileSystem  = (*contentCacheFileSystem)(nil)
+	_ ReadlinkFileSystem = (*contentCacheFileSystem)(nil)
+)
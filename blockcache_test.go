@@ -0,0 +1,181 @@
+package vfs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+)
+
+// contentDir returns a temporary directory with the file a. Files in mapfs
+// have no modification time, and aren't cached by CacheContent.
+func contentDir(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "vfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "a"), []byte(content), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestCacheContent(t *testing.T) {
+	var r recorder
+	content := strings.Repeat("0123456789", 10)
+	dir := contentDir(t, content)
+	defer os.RemoveAll(dir)
+	fs := vfs.CacheContent(vfs.Traced(vfs.OS(dir), &r), vfs.ContentCacheOptions{
+		BlockSize: 16,
+	})
+
+	for i := 0; i < 2; i++ {
+		f, err := fs.Open("/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("expected %q, got %q", content, b)
+		}
+	}
+	if !r.contains(`Open("/a")`) {
+		t.Errorf("expected the file to be opened, got %q", r)
+	}
+
+	r = nil
+	f, err := fs.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, off := range []int64{95, 3, 40, 17} {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 5)
+		n, err := io.ReadFull(f, b)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		if want := content[off:][:n]; string(b[:n]) != want {
+			t.Errorf("expected %q at %d, got %q", want, off, b[:n])
+		}
+	}
+	if r.contains(`Open("/a")`) {
+		t.Errorf("expected cached reads, got %q", r)
+	}
+
+	if _, err := fs.Open("/"); !errors.Is(err, vfs.ErrIsDir) {
+		t.Errorf("expected ErrIsDir, got %v", err)
+	}
+}
+
+func TestCacheContentOpenError(t *testing.T) {
+	dir := contentDir(t, "a")
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(filepath.Join(dir, "a"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := os.Open(filepath.Join(dir, "a")); err == nil {
+		f.Close()
+		t.Skip("file permissions are not enforced")
+	}
+
+	fs := vfs.CacheContent(vfs.OS(dir), vfs.ContentCacheOptions{})
+	if _, err := fs.Open("/a"); !os.IsPermission(err) {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+}
+
+func TestCacheContentNoModTime(t *testing.T) {
+	m := map[string]string{"a": "old"}
+	fs := vfs.CacheContent(mapfs.New(m), vfs.ContentCacheOptions{})
+
+	for _, want := range []string{"old", "new"} {
+		m["a"] = want
+		f, err := fs.Open("/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != want {
+			t.Errorf("expected %q, got %q", want, b)
+		}
+	}
+}
+
+func TestCacheContentDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var r recorder
+	content := bytes.Repeat([]byte("abcdefgh"), 8)
+	src := contentDir(t, string(content))
+	defer os.RemoveAll(src)
+	fs := vfs.CacheContent(vfs.Traced(vfs.OS(src), &r), vfs.ContentCacheOptions{
+		BlockSize: 8,
+		MaxMemory: 16,
+		Dir:       dir,
+		MaxDisk:   32,
+	})
+
+	read := func() {
+		f, err := fs.Open("/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, content) {
+			t.Errorf("expected %q, got %q", content, b)
+		}
+	}
+
+	read()
+	// Blocks are spilled to a directory of their own.
+	dirs, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 1 || !dirs[0].IsDir() {
+		t.Fatalf("expected a directory of spilled blocks, got %d files", len(dirs))
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, dirs[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 4; len(files) != want {
+		t.Errorf("expected %d spilled blocks, got %d", want, len(files))
+	}
+
+	// The first blocks were dropped from disk, the rest is read from the cache.
+	r = nil
+	read()
+	if !r.contains(`Open("/a")`) {
+		t.Errorf("expected the file to be reopened for dropped blocks, got %q", r)
+	}
+}
@@ -0,0 +1,224 @@
+package vfs
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// DefaultCacheEntries is the number of entries cached by CacheMeta if
+// CacheOptions.MaxEntries is not set.
+const DefaultCacheEntries = 4096
+
+// CacheOptions configure CacheMeta.
+type CacheOptions struct {
+	// TTL is how long results are cached. If zero, results are cached
+	// until they are evicted or invalidated.
+	TTL time.Duration
+
+	// NegativeTTL is how long not exist errors are cached. If zero, TTL is
+	// used; if negative, not exist errors aren't cached.
+	NegativeTTL time.Duration
+
+	// MaxEntries is the maximum number of cached results; the least
+	// recently used results are evicted first. If zero,
+	// DefaultCacheEntries is used.
+	MaxEntries int
+}
+
+// CachedFileSystem is a FileSystem caching metadata, see CacheMeta.
+type CachedFileSystem interface {
+	ContextFileSystem
+
+	// Invalidate removes the cached results for name, everything below
+	// it and the listing of its parent directory. If a parent of name is
+	// cached as not existing, the results for that parent are removed
+	// too, as if it was invalidated.
+	Invalidate(name string)
+}
+
+// CacheMeta returns a FileSystem that caches the results of Stat, Lstat and
+// Readdir on fs, including not exist errors. Other errors are not cached.
+// Files are opened on fs directly.
+//
+// Changes made to fs must be followed by a call to Invalidate to be visible
+// before the TTL expires.
+func CacheMeta(fs FileSystem, opts CacheOptions) CachedFileSystem {
+	if opts.NegativeTTL == 0 {
+		opts.NegativeTTL = opts.TTL
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultCacheEntries
+	}
+	return &cacheFileSystem{
+		fs:      fs,
+		opts:    opts,
+		lru:     list.New(),
+		entries: make(map[cacheKey]*list.Element),
+	}
+}
+
+// cacheKey identifies a cached result.
+type cacheKey struct {
+	op   string
+	name string
+}
+
+// cacheEntry is a cached result.
+type cacheEntry struct {
+	key     cacheKey
+	info    os.FileInfo
+	infos   []os.FileInfo
+	err     error
+	expires time.Time
+}
+
+type cacheFileSystem struct {
+	fs   FileSystem
+	opts CacheOptions
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[cacheKey]*list.Element
+}
+
+// get returns the cached result for key.
+func (fs *cacheFileSystem) get(key cacheKey) (*cacheEntry, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	e, ok := fs.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		fs.lru.Remove(e)
+		delete(fs.entries, key)
+		return nil, false
+	}
+	fs.lru.MoveToFront(e)
+	return entry, true
+}
+
+// put caches a result, unless err is an error that isn't cached.
+func (fs *cacheFileSystem) put(entry *cacheEntry) {
+	ttl := fs.opts.TTL
+	if entry.err != nil {
+		if !errors.Is(entry.err, os.ErrNotExist) || fs.opts.NegativeTTL < 0 {
+			return
+		}
+		ttl = fs.opts.NegativeTTL
+	}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if e, ok := fs.entries[entry.key]; ok {
+		fs.lru.Remove(e)
+	}
+	fs.entries[entry.key] = fs.lru.PushFront(entry)
+	for fs.lru.Len() > fs.opts.MaxEntries {
+		e := fs.lru.Back()
+		fs.lru.Remove(e)
+		delete(fs.entries, e.Value.(*cacheEntry).key)
+	}
+}
+
+func (fs *cacheFileSystem) Invalidate(name string) {
+	name = path.Clean("/" + name)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Creating name creates its missing parents, so start at the topmost
+	// parent cached as not existing.
+	for dir := path.Dir(name); dir != "/"; dir = path.Dir(dir) {
+		for _, op := range []string{"stat", "lstat", "readdir"} {
+			if e, ok := fs.entries[cacheKey{op, dir}]; ok && e.Value.(*cacheEntry).err != nil {
+				name = dir
+			}
+		}
+	}
+	parent := path.Dir(name)
+
+	for key, e := range fs.entries {
+		if hasPathPrefix(key.name, name) || (key.op == "readdir" && key.name == parent) {
+			fs.lru.Remove(e)
+			delete(fs.entries, key)
+		}
+	}
+}
+
+func (fs *cacheFileSystem) stat(op, name string, stat func(string) (os.FileInfo, error)) (os.FileInfo, error) {
+	key := cacheKey{op, path.Clean("/" + name)}
+	if entry, ok := fs.get(key); ok {
+		return entry.info, entry.err
+	}
+	info, err := stat(name)
+	fs.put(&cacheEntry{key: key, info: info, err: err})
+	return info, err
+}
+
+func (fs *cacheFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return fs.stat("lstat", name, fs.fs.Lstat)
+}
+
+func (fs *cacheFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.stat("stat", name, fs.fs.Stat)
+}
+
+func (fs *cacheFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	return fs.stat("stat", name, func(name string) (os.FileInfo, error) {
+		return StatContext(ctx, fs.fs, name)
+	})
+}
+
+func (fs *cacheFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs *cacheFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	key := cacheKey{"readdir", path.Clean("/" + name)}
+	entry, ok := fs.get(key)
+	if !ok {
+		infos, err := ReaddirContext(ctx, fs.fs, name)
+		entry = &cacheEntry{key: key, infos: infos, err: err}
+		fs.put(entry)
+	}
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	// Return a copy, callers may sort the result.
+	infos := make([]os.FileInfo, len(entry.infos))
+	copy(infos, entry.infos)
+	return infos, nil
+}
+
+func (fs *cacheFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.fs.Open(name)
+}
+
+func (fs *cacheFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	return OpenContext(ctx, fs.fs, name)
+}
+
+func (fs *cacheFileSystem) Readlink(name string) (string, error) {
+	return Readlink(fs.fs, name)
+}
+
+func (fs *cacheFileSystem) String() string {
+	return fs.fs.String()
+}
+
+var (
+	_ CachedFileSystem   = (*cacheFileSystem)(nil)
+	_ ReadlinkFileSystem = (*cacheFileSystem)(nil)
+)
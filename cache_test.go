@@ -0,0 +1,87 @@
+package vfs_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+)
+
+func TestCacheMeta(t *testing.T) {
+	var r recorder
+	fs := vfs.CacheMeta(vfs.Traced(mapfs.New(map[string]string{"a/b": "b"}), &r), vfs.CacheOptions{
+		TTL:        time.Hour,
+		MaxEntries: 4,
+	})
+
+	for i := 0; i < 2; i++ {
+		fs.Stat("/a/b")
+		fs.Lstat("/a/b")
+		fs.Readdir("/a")
+		if _, err := fs.Stat("/missing"); !os.IsNotExist(err) {
+			t.Errorf("expected a not exist error, got %v", err)
+		}
+	}
+	if want := 4; len(r) != want {
+		t.Errorf("expected %d calls, got %d: %q", want, len(r), r)
+	}
+
+	r = nil
+	fs.Invalidate("/a/b")
+	fs.Readdir("/a")
+	fs.Lstat("/a/b")
+	fs.Stat("/missing")
+	if want := 2; len(r) != want {
+		t.Errorf("expected %d calls after Invalidate, got %d: %q", want, len(r), r)
+	}
+
+	// Evict the least recently used Readdir.
+	r = nil
+	fs.Stat("/c")
+	fs.Stat("/d")
+	fs.Readdir("/a")
+	if want := 3; len(r) != want {
+		t.Errorf("expected %d calls after eviction, got %d: %q", want, len(r), r)
+	}
+}
+
+func TestCacheMetaInvalidateParents(t *testing.T) {
+	m := map[string]string{"a": "a"}
+	fs := vfs.CacheMeta(mapfs.New(m), vfs.CacheOptions{})
+
+	for _, name := range []string{"/x", "/x/y", "/x/y/z"} {
+		if _, err := fs.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("Stat(%q): expected a not exist error, got %v", name, err)
+		}
+	}
+	fs.Readdir("/")
+
+	m["x/y/z"] = "z"
+	fs.Invalidate("/x/y/z")
+	for _, name := range []string{"/x", "/x/y", "/x/y/z"} {
+		if _, err := fs.Stat(name); err != nil {
+			t.Errorf("Stat(%q) after Invalidate: %v", name, err)
+		}
+	}
+	if infos, err := fs.Readdir("/"); err != nil || len(infos) != 2 {
+		t.Errorf("expected 2 entries after Invalidate, got %d, %v", len(infos), err)
+	}
+}
+
+func TestCacheMetaTTL(t *testing.T) {
+	var r recorder
+	fs := vfs.CacheMeta(vfs.Traced(mapfs.New(map[string]string{"a": "a"}), &r), vfs.CacheOptions{
+		TTL:         time.Hour,
+		NegativeTTL: -1,
+	})
+
+	fs.Stat("/a")
+	fs.Stat("/a")
+	fs.Stat("/missing")
+	fs.Stat("/missing")
+	if want := 3; len(r) != want {
+		t.Errorf("expected %d calls, got %d: %q", want, len(r), r)
+	}
+}
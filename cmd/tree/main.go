@@ -4,9 +4,6 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
-	"path"
-	"strings"
 
 	"textmodes.com/vfs"
 	"textmodes.com/vfs/autofs"
@@ -24,63 +21,43 @@ func main() {
 		os.Exit(1)
 	}
 
-	if vfs.Trace {
-		fmt.Fprintf(os.Stderr, "%d open files\n", openFiles())
-	}
-
-	fs, err := autofs.New(flag.Arg(0))
+	afs, err := autofs.New(flag.Arg(0))
 	if err != nil {
 		panic(err)
 	}
-
-	dump(fs, "/", 0)
-
+	var tracked vfs.TrackedFileSystem
 	if vfs.Trace {
-		fmt.Fprintf(os.Stderr, "%d open files\n", openFiles())
-	}
-}
-
-func dump(fs vfs.FileSystem, base string, depth int) {
-	pad := strings.Repeat("  ", depth)
-
-	i, err := fs.Stat(base)
-	if err != nil {
-		fmt.Printf("%s%s error: %v\n", pad, base, err)
-		return
-	}
-
-	if !i.IsDir() {
-		return
+		tracked = vfs.TrackHandles(afs)
+		afs = tracked
 	}
+	fs := vfs.CacheMeta(afs, vfs.CacheOptions{})
 
-	d, err := fs.Readdir(base)
-	if err != nil {
-		fmt.Printf("%s%s error: %v\n", pad, base, err)
-		return
-	}
-
-	//fmt.Printf("%s%s: (%s, %d children, %T: %#+v): %T %#+v\n", base, pad, i.Name(), len(d), fs, fs, i, i)
-	//fmt.Printf("%s%s:\n", pad, path.Base(base))
-	fmt.Printf("%s %9d %s %s\n", i.Mode(), len(d), i.ModTime().Format("Jan 02 15:04"), base)
-
-	//var dirs []string
-	for _, i := range d {
+	err = vfs.Walk(fs, "/", func(name string, i os.FileInfo, err error) error {
+		if err != nil {
+			fmt.Printf("%s error: %v\n", name, err)
+			return nil
+		}
+		size := i.Size()
 		if i.IsDir() {
-			dump(fs, path.Join(base, path.Base(i.Name())), depth+1)
-		} else {
-			fmt.Printf("%s %9d %s %s\n", i.Mode(), i.Size(), i.ModTime().Format("Jan 02 15:04"), path.Join(base, path.Base(i.Name())))
+			// Directories show the number of children.
+			d, err := fs.Readdir(name)
+			if err != nil {
+				fmt.Printf("%s error: %v\n", name, err)
+				return nil
+			}
+			size = int64(len(d))
 		}
-	}
-	if depth == 1 {
-		fmt.Println("")
-	}
-}
-
-func openFiles() int {
-	out, err := exec.Command("/bin/sh", "-c", fmt.Sprintf("lsof -p %d", os.Getpid())).Output()
+		fmt.Printf("%s %9d %s %s\n", i.Mode(), size, i.ModTime().Format("Jan 02 15:04"), name)
+		return nil
+	})
 	if err != nil {
 		panic(err)
 	}
-	lines := strings.Split(string(out), "\n")
-	return len(lines) - 1
+
+	if tracked != nil {
+		// Internal handles are reported apart from the leaked ones, they
+		// belong to the files of archives that are still open.
+		tracked.Close()
+		tracked.Report(os.Stderr)
+	}
 }
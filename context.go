@@ -0,0 +1,77 @@
+package vfs
+
+import (
+	"context"
+	"os"
+)
+
+// OpenContext opens name in fs. If fs is not a ContextFileSystem, ctx is only
+// checked before calling fs.Open.
+func OpenContext(ctx context.Context, fs FileSystem, name string) (ReadSeekCloser, error) {
+	if cfs, ok := fs.(ContextFileSystem); ok {
+		return cfs.OpenContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.Open(name)
+}
+
+// StatContext returns the os.FileInfo for name in fs. If fs is not a
+// ContextFileSystem, ctx is only checked before calling fs.Stat.
+func StatContext(ctx context.Context, fs FileSystem, name string) (os.FileInfo, error) {
+	if cfs, ok := fs.(ContextFileSystem); ok {
+		return cfs.StatContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.Stat(name)
+}
+
+// ReaddirContext returns the contents of the directory name in fs. If fs is
+// not a ContextFileSystem, ctx is only checked before calling fs.Readdir.
+func ReaddirContext(ctx context.Context, fs FileSystem, name string) ([]os.FileInfo, error) {
+	if cfs, ok := fs.(ContextFileSystem); ok {
+		return cfs.ReaddirContext(ctx, name)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.Readdir(name)
+}
+
+// WithContext returns a FileSystem that performs all operations on fs with
+// ctx, for example to serve fs with HTTPFileSystem for the duration of a
+// single request.
+func WithContext(ctx context.Context, fs FileSystem) FileSystem {
+	return contextFileSystem{ctx, fs}
+}
+
+type contextFileSystem struct {
+	ctx context.Context
+	fs  FileSystem
+}
+
+func (fs contextFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return OpenContext(fs.ctx, fs.fs, name)
+}
+
+func (fs contextFileSystem) Lstat(name string) (os.FileInfo, error) {
+	if err := fs.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.fs.Lstat(name)
+}
+
+func (fs contextFileSystem) Stat(name string) (os.FileInfo, error) {
+	return StatContext(fs.ctx, fs.fs, name)
+}
+
+func (fs contextFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return ReaddirContext(fs.ctx, fs.fs, name)
+}
+
+func (fs contextFileSystem) String() string {
+	return fs.fs.String()
+}
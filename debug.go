@@ -2,19 +2,84 @@ package vfs
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"strings"
 )
 
 var (
-	// Trace enable flag.
+	// Trace enable flag. When set, file systems without a Tracer of their
+	// own trace to DefaultTracer.
 	Trace bool
+
+	// DefaultTracer receives the trace messages of all file systems without
+	// a Tracer of their own, if Trace is set.
+	DefaultTracer Tracer = NewLogTracer(log.New(os.Stderr, "", 0))
 )
 
-// Tracef is a debug helper.
+// Tracer receives trace messages of file system operations.
+type Tracer interface {
+	Tracef(fs FileSystem, format string, v ...interface{})
+}
+
+// TracerFunc is an adapter to use an ordinary function as a Tracer.
+type TracerFunc func(fs FileSystem, format string, v ...interface{})
+
+// Tracef calls f(fs, format, v...).
+func (f TracerFunc) Tracef(fs FileSystem, format string, v ...interface{}) {
+	f(fs, format, v...)
+}
+
+// NewLogTracer returns a Tracer that writes trace messages to l, prefixed with
+// the file system.
+func NewLogTracer(l *log.Logger) Tracer {
+	return logTracer{l}
+}
+
+type logTracer struct {
+	*log.Logger
+}
+
+func (t logTracer) Tracef(fs FileSystem, format string, v ...interface{}) {
+	format = strings.TrimRight(format, " \t\r\n")
+	t.Printf("vfs %s: "+format, append([]interface{}{fs}, v...)...)
+}
+
+// TracerFileSystem is a FileSystem that can trace its operations to a Tracer
+// of its own, independent of the global Trace flag. The archive backends and
+// autofs implement it.
+type TracerFileSystem interface {
+	FileSystem
+
+	// Tracer returns the Tracer of the file system, or nil.
+	Tracer() Tracer
+
+	// SetTracer sets the Tracer of the file system, nil restores tracing
+	// to DefaultTracer. It may be called while the file system is in use.
+	SetTracer(t Tracer)
+}
+
+// SetTracer attaches t to fs. If fs is not a TracerFileSystem, an error
+// wrapping ErrNotSupported is returned; use Traced to trace these.
+func SetTracer(fs FileSystem, t Tracer) error {
+	tfs, ok := fs.(TracerFileSystem)
+	if !ok {
+		return fmt.Errorf("vfs: tracing %s: %w", fs, ErrNotSupported)
+	}
+	tfs.SetTracer(t)
+	return nil
+}
+
+// Tracef is a debug helper. The message goes to the Tracer of fs if it has
+// one, or to DefaultTracer if Trace is set.
 func Tracef(fs FileSystem, format string, v ...interface{}) {
+	if tfs, ok := fs.(TracerFileSystem); ok {
+		if t := tfs.Tracer(); t != nil {
+			t.Tracef(fs, format, v...)
+			return
+		}
+	}
 	if Trace {
-		format = strings.TrimRight(format, " \t\r\n") + "\n"
-		fmt.Fprintf(os.Stderr, "vfs %s: "+format, append([]interface{}{fs}, v...)...)
+		DefaultTracer.Tracef(fs, format, v...)
 	}
 }
@@ -1,7 +1,6 @@
 package vfs
 
 import (
-	"errors"
 	"os"
 	"time"
 )
@@ -12,9 +11,9 @@ type empty struct{}
 // open a file will return errors.
 func (empty) Open(name string) (ReadSeekCloser, error) {
 	if name == "/" {
-		return nil, errors.New("open: / is a directory")
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrIsDir}
 	}
-	return nil, os.ErrNotExist
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
 }
 
 // Stat returns os.FileInfo for an empty directory if the path is
@@ -23,7 +22,7 @@ func (e empty) Stat(path string) (os.FileInfo, error) {
 	if path == "/" {
 		return e, nil
 	}
-	return nil, os.ErrNotExist
+	return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
 }
 
 func (e *empty) Lstat(path string) (os.FileInfo, error) {
@@ -35,7 +34,7 @@ func (empty) Readdir(path string) ([]os.FileInfo, error) {
 	if path == "/" {
 		return []os.FileInfo{}, nil
 	}
-	return nil, os.ErrNotExist
+	return nil, &os.PathError{Op: "readdir", Path: path, Err: os.ErrNotExist}
 }
 
 func (empty) String() string {
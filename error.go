@@ -1,8 +1,31 @@
 package vfs
 
-import "errors"
+import (
+	"errors"
+	"os"
+)
 
-// Common errors.
+// Common errors. FileSystem implementations return these wrapped in an
+// *os.PathError, use errors.Is to test for them.
 var (
-	ErrNotSupported = errors.New("vfs: not supported")
+	ErrNotSupported     = errors.New("vfs: not supported")
+	ErrSymlinkLoop      = errors.New("vfs: too many levels of symbolic links")
+	ErrIsDir            = errors.New("vfs: is a directory")
+	ErrNotDir           = errors.New("vfs: not a directory")
+	ErrEncrypted        = errors.New("vfs: encrypted")
+	ErrCorrupt          = errors.New("vfs: corrupt archive")
+	ErrPasswordRequired = errors.New("vfs: password required")
+	ErrTooLarge         = errors.New("vfs: file too large")
+	ErrAmbiguous        = errors.New("vfs: ambiguous name")
+	ErrNotRecorded      = errors.New("vfs: not recorded")
 )
+
+// withPath returns err with the path of its *os.PathError replaced by name,
+// for errors of mounted file systems, which report paths relative to the
+// mount.
+func withPath(err error, name string) error {
+	if err, ok := err.(*os.PathError); ok && err.Path != name {
+		return &os.PathError{Op: err.Op, Path: name, Err: err.Err}
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package vfs_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/autofs"
+	"textmodes.com/vfs/zipfs"
+)
+
+func TestScopeErrors(t *testing.T) {
+	zfs, err := zipfs.Open("testdata/zip/unix.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := vfs.NewScope()
+	scope.Bind("/zip", "/", zfs, vfs.BindReplace)
+	afs, err := autofs.New("testdata/zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		op, path string
+		err      error
+		want     error
+	}{
+		{"open", "/zip/dir", open(scope, "/zip/dir"), vfs.ErrIsDir},
+		{"open", "/zip/missing", open(scope, "/zip/missing"), os.ErrNotExist},
+		{"readdir", "/zip/hello", readdir(scope, "/zip/hello"), vfs.ErrNotDir},
+		{"stat", "/zip/dir/missing", stat(scope, "/zip/dir/missing"), os.ErrNotExist},
+		{"open", "/unix.zip/dir", open(afs, "/unix.zip/dir"), vfs.ErrIsDir},
+		{"stat", "/unix.zip/missing", stat(afs, "/unix.zip/missing"), os.ErrNotExist},
+		{"open", "/missing", open(afs, "/missing"), os.ErrNotExist},
+		{"seek", "/dir/bar", seek(zfs, "/dir/bar"), os.ErrInvalid},
+		{"seek", "/zip/unix.zip", seek(vfs.CacheContent(vfs.OS("testdata"), vfs.ContentCacheOptions{}), "/zip/unix.zip"), os.ErrInvalid},
+	}
+	for _, test := range tests {
+		if !errors.Is(test.err, test.want) {
+			t.Errorf("expected %v, got %v", test.want, test.err)
+		}
+		var pathErr *os.PathError
+		if !errors.As(test.err, &pathErr) {
+			t.Errorf("expected an *os.PathError, got %T", test.err)
+		} else if pathErr.Op != test.op {
+			t.Errorf("expected op %q, got %q", test.op, pathErr.Op)
+		} else if pathErr.Path != test.path {
+			t.Errorf("expected path %q, got %q", test.path, pathErr.Path)
+		}
+	}
+}
+
+func open(fs vfs.FileSystem, name string) error {
+	f, err := fs.Open(name)
+	if err == nil {
+		f.Close()
+	}
+	return err
+}
+
+// seek returns the error of seeking to a negative offset.
+func seek(fs vfs.FileSystem, name string) error {
+	f, err := fs.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Seek(-1, io.SeekStart)
+	return err
+}
+
+func readdir(fs vfs.FileSystem, name string) error {
+	_, err := fs.Readdir(name)
+	return err
+}
+
+func stat(fs vfs.FileSystem, name string) error {
+	_, err := fs.Stat(name)
+	return err
+}
@@ -0,0 +1,229 @@
+package vfs
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// FaultRule selects the calls a fault is injected into, and the fault.
+type FaultRule struct {
+	// Op is the operation: "open", "stat", "lstat", "readdir", "readlink",
+	// or "read" and "seek" on opened files. If empty, any operation
+	// matches.
+	Op string
+
+	// Path is a pattern in the syntax of Match. If empty, any path
+	// matches.
+	Path string
+
+	// Nth makes the fault fire on the Nth matching call only, counting
+	// from 1. If zero, every matching call is a candidate.
+	Nth int
+
+	// Probability is the probability of the fault firing on a candidate
+	// call. If zero, it always fires.
+	Probability float64
+
+	// Delay delays the call.
+	Delay time.Duration
+
+	// Err is returned by the call, wrapped in an *os.PathError.
+	Err error
+
+	// ShortRead limits the number of bytes returned by a read.
+	ShortRead int
+
+	// Truncate limits the number of entries returned by Readdir.
+	Truncate int
+}
+
+// FaultRules configure Faulty.
+type FaultRules struct {
+	Rules []FaultRule
+
+	// Seed seeds the random decisions of rules with a Probability, so
+	// failures can be reproduced. If zero, a random seed is used.
+	Seed int64
+}
+
+// Faulty returns a FileSystem that injects faults into the operations on fs,
+// to test how its users cope with failing file systems, such as a corrupt
+// archive in the middle of a Walk. The first rule that matches a call and
+// fires injects its fault; if a matching rule doesn't fire, because of its
+// Nth or Probability, the later rules are tried.
+//
+// Faulty returns path.ErrBadPattern if the Path of a rule is malformed.
+func Faulty(fs FileSystem, rules FaultRules) (FileSystem, error) {
+	for _, rule := range rules.Rules {
+		if _, err := Match(rule.Path, "/"); err != nil {
+			return nil, err
+		}
+	}
+	seed := rules.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &faultyFileSystem{
+		fs:    fs,
+		rules: rules.Rules,
+		calls: make([]int, len(rules.Rules)),
+		rand:  rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+type faultyFileSystem struct {
+	fs    FileSystem
+	rules []FaultRule
+
+	mu    sync.Mutex
+	calls []int // matching calls by rule
+	rand  *rand.Rand
+}
+
+// fault returns the fault to inject into a call of op on name, or nil.
+func (fs *faultyFileSystem) fault(op, name string) *FaultRule {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	name = path.Clean("/" + name)
+	for i := range fs.rules {
+		rule := &fs.rules[i]
+		if rule.Op != "" && rule.Op != op {
+			continue
+		}
+		if rule.Path != "" {
+			if ok, _ := Match(rule.Path, name); !ok {
+				continue
+			}
+		}
+		fs.calls[i]++
+		if rule.Nth > 0 && fs.calls[i] != rule.Nth {
+			continue
+		}
+		if rule.Probability > 0 && fs.rand.Float64() >= rule.Probability {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+// inject injects the fault for a call of op on name, if any. It returns the
+// fault and the error the call should fail with.
+func (fs *faultyFileSystem) inject(ctx context.Context, op, name string) (*FaultRule, error) {
+	rule := fs.fault(op, name)
+	if rule == nil {
+		return nil, nil
+	}
+	if rule.Delay > 0 {
+		Tracef(fs, "Faulty: delaying %s %s by %v", op, name, rule.Delay)
+		t := time.NewTimer(rule.Delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return rule, &os.PathError{Op: op, Path: name, Err: ctx.Err()}
+		}
+	}
+	if rule.Err != nil {
+		Tracef(fs, "Faulty: failing %s %s with %v", op, name, rule.Err)
+		return rule, &os.PathError{Op: op, Path: name, Err: rule.Err}
+	}
+	return rule, nil
+}
+
+func (fs *faultyFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *faultyFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	if _, err := fs.inject(ctx, "open", name); err != nil {
+		return nil, err
+	}
+	f, err := OpenContext(ctx, fs.fs, name)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{ReadSeekCloser: f, fs: fs, name: name}, nil
+}
+
+func (fs *faultyFileSystem) Lstat(name string) (os.FileInfo, error) {
+	if _, err := fs.inject(context.Background(), "lstat", name); err != nil {
+		return nil, err
+	}
+	return fs.fs.Lstat(name)
+}
+
+func (fs *faultyFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.StatContext(context.Background(), name)
+}
+
+func (fs *faultyFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	if _, err := fs.inject(ctx, "stat", name); err != nil {
+		return nil, err
+	}
+	return StatContext(ctx, fs.fs, name)
+}
+
+func (fs *faultyFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs *faultyFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	rule, err := fs.inject(ctx, "readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ReaddirContext(ctx, fs.fs, name)
+	if err == nil && rule != nil && rule.Truncate > 0 && len(infos) > rule.Truncate {
+		Tracef(fs, "Faulty: truncating readdir %s to %d entries", name, rule.Truncate)
+		infos = infos[:rule.Truncate]
+	}
+	return infos, err
+}
+
+func (fs *faultyFileSystem) Readlink(name string) (string, error) {
+	if _, err := fs.inject(context.Background(), "readlink", name); err != nil {
+		return "", err
+	}
+	return Readlink(fs.fs, name)
+}
+
+func (fs *faultyFileSystem) String() string {
+	return fs.fs.String()
+}
+
+// faultyFile injects faults into the reads and seeks of a file opened by a
+// faultyFileSystem.
+type faultyFile struct {
+	ReadSeekCloser
+	fs   *faultyFileSystem
+	name string
+}
+
+func (f *faultyFile) Read(p []byte) (int, error) {
+	rule, err := f.fs.inject(context.Background(), "read", f.name)
+	if err != nil {
+		return 0, err
+	}
+	if rule != nil && rule.ShortRead > 0 && len(p) > rule.ShortRead {
+		p = p[:rule.ShortRead]
+	}
+	return f.ReadSeekCloser.Read(p)
+}
+
+func (f *faultyFile) Seek(offset int64, whence int) (int64, error) {
+	if _, err := f.fs.inject(context.Background(), "seek", f.name); err != nil {
+		return 0, err
+	}
+	return f.ReadSeekCloser.Seek(offset, whence)
+}
+
+var (
+	_ ContextFileSystem  = (*faultyFileSystem)(nil)
+	_ ReadlinkFileSystem = (*faultyFileSystem)(nil)
+)
@@ -0,0 +1,132 @@
+package vfs_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+)
+
+func TestFaulty(t *testing.T) {
+	fs, err := vfs.Faulty(mapfs.New(map[string]string{
+		"a/1":   "1",
+		"a/2":   "2",
+		"b/x":   "abcdef",
+		"c.zip": "zip",
+	}), vfs.FaultRules{Rules: []vfs.FaultRule{
+		{Op: "readdir", Path: "/c.zip", Err: vfs.ErrCorrupt},
+		{Op: "readdir", Path: "/a", Truncate: 1},
+		{Op: "stat", Path: "/b/*", Nth: 2, Err: os.ErrPermission},
+		{Op: "read", Path: "/b/x", ShortRead: 2},
+		{Op: "seek", Err: vfs.ErrNotSupported},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Readdir("/c.zip"); !errors.Is(err, vfs.ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt, got %v", err)
+	}
+	if infos, err := fs.Readdir("/a"); err != nil || len(infos) != 1 {
+		t.Errorf("expected 1 entry, got %d, %v", len(infos), err)
+	}
+
+	for i, want := range []error{nil, os.ErrPermission, nil} {
+		if _, err := fs.Stat("/b/x"); !errors.Is(err, want) && err != want {
+			t.Errorf("Stat %d: expected %v, got %v", i+1, want, err)
+		}
+	}
+
+	f, err := fs.Open("/b/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if n, err := f.Read(make([]byte, 10)); n != 2 || err != nil {
+		t.Errorf("expected a short read of 2 bytes, got %d, %v", n, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); !errors.Is(err, vfs.ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestFaultyFallThrough(t *testing.T) {
+	// Rules that match but don't fire leave the call to the later rules.
+	fs, err := vfs.Faulty(mapfs.New(map[string]string{"a": "a"}), vfs.FaultRules{Rules: []vfs.FaultRule{
+		{Op: "stat", Nth: 2, Err: os.ErrPermission},
+		{Op: "stat", Path: "/a", Err: vfs.ErrCorrupt},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []error{vfs.ErrCorrupt, os.ErrPermission, vfs.ErrCorrupt} {
+		if _, err := fs.Stat("/a"); !errors.Is(err, want) {
+			t.Errorf("Stat %d: expected %v, got %v", i+1, want, err)
+		}
+	}
+}
+
+func TestFaultyWalk(t *testing.T) {
+	fs, err := vfs.Faulty(mapfs.New(map[string]string{
+		"a/1":       "1",
+		"b.zip/x/1": "1",
+		"c/1":       "1",
+	}), vfs.FaultRules{Rules: []vfs.FaultRule{
+		{Op: "readdir", Path: "/b.zip/**", Err: vfs.ErrCorrupt},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failed, visited []string
+	err = vfs.Walk(fs, "/", func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if !errors.Is(err, vfs.ErrCorrupt) {
+				t.Errorf("%s: expected ErrCorrupt, got %v", name, err)
+			}
+			failed = append(failed, name)
+			return nil
+		}
+		visited = append(visited, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0] != "/b.zip" {
+		t.Errorf("expected /b.zip to fail, got %q", failed)
+	}
+	if visited[len(visited)-1] != "/c/1" {
+		t.Errorf("expected the walk to continue after the failure, got %q", visited)
+	}
+}
+
+func TestFaultySeed(t *testing.T) {
+	run := func() (failures []int) {
+		fs, err := vfs.Faulty(mapfs.New(map[string]string{"a": "a"}), vfs.FaultRules{
+			Rules: []vfs.FaultRule{{Op: "stat", Probability: 0.5, Err: vfs.ErrCorrupt}},
+			Seed:  42,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			if _, err := fs.Stat("/a"); err != nil {
+				failures = append(failures, i)
+			}
+		}
+		return failures
+	}
+
+	first, second := run(), run()
+	if len(first) == 0 || len(first) == 20 {
+		t.Errorf("expected some calls to fail, got %v", first)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("expected the same failures, got %v and %v", first, second)
+	}
+}
@@ -0,0 +1,282 @@
+package vfs
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// JunkRules are the rules for files left behind by operating systems, such
+// as macOS resource forks and Windows thumbnail caches, that litter archives.
+var JunkRules = []string{
+	"__MACOSX/",
+	".DS_Store",
+	"Thumbs.db",
+	"desktop.ini",
+}
+
+// FilterRules configure Filter.
+type FilterRules struct {
+	// Rules are lines in .gitignore syntax, applied to the whole file
+	// system: patterns without a slash match at any depth, a trailing
+	// slash matches only directories, a leading "!" negates the pattern
+	// and the last matching rule wins.
+	Rules []string
+
+	// RuleFile is the name of rule files, such as ".gitignore". If set,
+	// the rules in files of that name found in the tree apply to the
+	// directory containing them and take precedence over Rules and the
+	// rule files of parent directories, like git does.
+	RuleFile string
+}
+
+// Filter returns a FileSystem that hides the files of fs excluded by rules.
+// Excluded files appear not to exist to all operations, and files in excluded
+// directories can't be included again. Since rules are matched against
+// paths, they also apply inside archives presented as directories, for
+// example by autofs.
+//
+// Filter returns path.ErrBadPattern if one of the rules is malformed. Rule
+// files are read as needed, malformed rules in them are ignored.
+func Filter(fs FileSystem, rules FilterRules) (FileSystem, error) {
+	parsed, err := parseRules("/", rules.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return &filteredFileSystem{
+		fs:       fs,
+		rules:    parsed,
+		ruleFile: rules.RuleFile,
+		dirRules: make(map[string][]filterRule),
+	}, nil
+}
+
+// filterRule is a parsed line of a rule file.
+type filterRule struct {
+	base     string // directory the rule applies to
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // match the path relative to base, not just the name
+}
+
+// parseRules parses lines in .gitignore syntax, for a rule file in base.
+func parseRules(base string, lines []string) ([]filterRule, error) {
+	var rules []filterRule
+	for _, line := range lines {
+		line = trimTrailingSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		rule := filterRule{base: base}
+		if line[0] == '!' {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if strings.HasSuffix(line, "/**") {
+			// Everything inside, but not the directory itself.
+			line += "/*"
+		}
+		if line == "" {
+			continue
+		}
+		// fnmatch negates character classes with "!", path.Match with "^".
+		rule.pattern = strings.Replace(line, "[!", "[^", -1)
+
+		if _, err := Match(rule.pattern, "/"); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// trimTrailingSpace removes trailing spaces from line, unless they are
+// escaped with a backslash.
+func trimTrailingSpace(line string) string {
+	line = strings.TrimRight(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// match reports whether the rule matches name, a path below its base.
+func (rule filterRule) match(name string, isDir func() bool) bool {
+	var ok bool
+	if rule.anchored {
+		rel := strings.TrimPrefix(name, rule.base)
+		ok, _ = Match(rule.pattern, rel)
+	} else {
+		ok, _ = path.Match(rule.pattern, path.Base(name))
+	}
+	return ok && (!rule.dirOnly || isDir())
+}
+
+type filteredFileSystem struct {
+	fs       FileSystem
+	rules    []filterRule
+	ruleFile string
+
+	mu       sync.Mutex
+	dirRules map[string][]filterRule // rule files read so far, by directory
+}
+
+// readRules returns the rules of the rule file in dir.
+func (fs *filteredFileSystem) readRules(dir string) []filterRule {
+	if fs.ruleFile == "" {
+		return nil
+	}
+
+	fs.mu.Lock()
+	rules, ok := fs.dirRules[dir]
+	fs.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	name := path.Join(dir, fs.ruleFile)
+	if f, err := fs.fs.Open(name); err == nil {
+		var lines []string
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		f.Close()
+		if rules, err = parseRules(strings.TrimSuffix(dir, "/")+"/", lines); err != nil {
+			Tracef(fs, "Filter: %s: %v", name, err)
+		}
+	}
+
+	fs.mu.Lock()
+	fs.dirRules[dir] = rules
+	fs.mu.Unlock()
+	return rules
+}
+
+// excluded reports whether name or one of its parent directories is excluded.
+// isDir is only called if needed for rules matching directories only.
+func (fs *filteredFileSystem) excluded(name string, isDir func() bool) bool {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return false
+	}
+
+	rules := fs.rules
+	dir := "/"
+	elems := strings.Split(name[1:], "/")
+	for i, elem := range elems {
+		if more := fs.readRules(dir); len(more) > 0 {
+			rules = append(rules[:len(rules):len(rules)], more...)
+		}
+
+		name := path.Join(dir, elem)
+		isDir := isDir
+		if i < len(elems)-1 {
+			isDir = func() bool { return true }
+		}
+		for j := len(rules) - 1; j >= 0; j-- {
+			if rules[j].match(name, isDir) {
+				if !rules[j].negate {
+					return true
+				}
+				break
+			}
+		}
+		dir = name
+	}
+	return false
+}
+
+// check returns a not exist error if name is excluded.
+func (fs *filteredFileSystem) check(op, name string) error {
+	isDir := func() bool {
+		info, err := fs.fs.Lstat(name)
+		return err == nil && info.IsDir()
+	}
+	if fs.excluded(name, isDir) {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+func (fs *filteredFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *filteredFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	if err := fs.check("open", name); err != nil {
+		return nil, err
+	}
+	return OpenContext(ctx, fs.fs, name)
+}
+
+func (fs *filteredFileSystem) Lstat(name string) (os.FileInfo, error) {
+	if err := fs.check("lstat", name); err != nil {
+		return nil, err
+	}
+	return fs.fs.Lstat(name)
+}
+
+func (fs *filteredFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.StatContext(context.Background(), name)
+}
+
+func (fs *filteredFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	if err := fs.check("stat", name); err != nil {
+		return nil, err
+	}
+	return StatContext(ctx, fs.fs, name)
+}
+
+func (fs *filteredFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs *filteredFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	if err := fs.check("readdir", name); err != nil {
+		return nil, err
+	}
+	infos, err := ReaddirContext(ctx, fs.fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Clean("/" + name)
+	included := infos[:0:0]
+	for _, info := range infos {
+		info := info
+		if !fs.excluded(path.Join(dir, info.Name()), info.IsDir) {
+			included = append(included, info)
+		}
+	}
+	return included, nil
+}
+
+func (fs *filteredFileSystem) Readlink(name string) (string, error) {
+	if err := fs.check("readlink", name); err != nil {
+		return "", err
+	}
+	return Readlink(fs.fs, name)
+}
+
+func (fs *filteredFileSystem) String() string {
+	return fs.fs.String()
+}
+
+var (
+	_ ContextFileSystem  = (*filteredFileSystem)(nil)
+	_ ReadlinkFileSystem = (*filteredFileSystem)(nil)
+)
@@ -0,0 +1,83 @@
+package vfs_test
+
+import (
+	"os"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+)
+
+func TestFilter(t *testing.T) {
+	fs, err := vfs.Filter(mapfs.New(map[string]string{
+		"a.txt":                 "a",
+		"a.log":                 "a",
+		"keep.log":              "keep",
+		".DS_Store":             "junk",
+		"__MACOSX/._a.txt":      "junk",
+		"build/out":             "out",
+		"doc/build":             "file",
+		"doc/.gitignore":        "# comment\n*.txt\n!readme.txt\n/tmp/\n",
+		"doc/readme.txt":        "readme",
+		"doc/notes.txt":         "notes",
+		"doc/tmp/x":             "x",
+		"doc/sub/tmp/x":         "x",
+		"archive.zip/Thumbs.db": "junk",
+	}), vfs.FilterRules{
+		Rules:    append([]string{"*.log", "!keep.log", "build/"}, vfs.JunkRules...),
+		RuleFile: ".gitignore",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{
+		"/a.txt":                 true,
+		"/a.log":                 false,
+		"/keep.log":              true,
+		"/.DS_Store":             false,
+		"/__MACOSX":              false,
+		"/__MACOSX/._a.txt":      false,
+		"/build":                 false,
+		"/build/out":             false,
+		"/doc/build":             true,
+		"/doc/.gitignore":        true,
+		"/doc/readme.txt":        true,
+		"/doc/notes.txt":         false,
+		"/doc/tmp/x":             false,
+		"/doc/sub/tmp/x":         true,
+		"/archive.zip/Thumbs.db": false,
+	} {
+		_, err := fs.Stat(name)
+		if want && err != nil {
+			t.Errorf("Stat(%q): expected no error, got %v", name, err)
+		} else if !want && !os.IsNotExist(err) {
+			t.Errorf("Stat(%q): expected a not exist error, got %v", name, err)
+		}
+	}
+
+	infos, err := fs.Readdir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	want := []string{"a.txt", "archive.zip", "doc", "keep.log"}
+	if len(names) != len(want) {
+		t.Fatalf("expected %q, got %q", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("expected %q, got %q", want, names)
+		}
+	}
+
+	if _, err := fs.Open("/doc/notes.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if _, err := vfs.Filter(fs, vfs.FilterRules{Rules: []string{"[a"}}); err == nil {
+		t.Error("expected an error for a malformed rule")
+	}
+}
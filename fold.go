@@ -0,0 +1,280 @@
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// FoldOptions configure Fold.
+type FoldOptions struct {
+	// Case makes lookups case-insensitive, using Unicode simple case
+	// folding.
+	Case bool
+
+	// Normalize makes lookups insensitive to the Unicode normalization
+	// form, so names stored in NFD, as macOS does, are found by their
+	// NFC spelling and vice versa.
+	Normalize bool
+}
+
+// key returns the string names are compared by.
+func (opts FoldOptions) key(name string) string {
+	if opts.Normalize {
+		name = decompose(name)
+	}
+	if opts.Case {
+		name = strings.Map(foldRune, name)
+	}
+	return name
+}
+
+// Fold returns a FileSystem that resolves paths in fs the way opts allows,
+// so that names in archives made on case-insensitive or normalizing systems,
+// and links pointing into them, can be found. Stored names always take
+// precedence; Stat and Readdir report names as stored.
+//
+// If a name matches more than one entry of a directory, but none exactly,
+// the lookup fails with an error wrapping ErrAmbiguous. Use FoldCollisions to
+// find these entries.
+func Fold(fs FileSystem, opts FoldOptions) FileSystem {
+	return foldFileSystem{fs, opts}
+}
+
+// FoldCollisions returns the groups of entries of the directory name in fs
+// that opts can't tell apart, sorted by name.
+func FoldCollisions(fs FileSystem, name string, opts FoldOptions) ([][]string, error) {
+	infos, err := fs.Readdir(name)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]string)
+	for _, info := range infos {
+		k := opts.key(info.Name())
+		groups[k] = append(groups[k], info.Name())
+	}
+
+	var collisions [][]string
+	for _, names := range groups {
+		if len(names) > 1 {
+			sort.Strings(names)
+			collisions = append(collisions, names)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i][0] < collisions[j][0]
+	})
+	return collisions, nil
+}
+
+type foldFileSystem struct {
+	fs   FileSystem
+	opts FoldOptions
+}
+
+// resolve returns the stored path of name. If follow is set, a symbolic link
+// in the last element of name is resolved as well.
+func (fs foldFileSystem) resolve(op, name string, follow bool) (string, error) {
+	stat := fs.fs.Lstat
+	if follow {
+		stat = fs.fs.Stat
+	}
+	if _, err := stat(name); err == nil {
+		return name, nil
+	}
+
+	rfs, _ := fs.fs.(ReadlinkFileSystem)
+	var (
+		dest  = "/"
+		elems = strings.Split(name, "/")
+		links int
+	)
+	for len(elems) > 0 {
+		elem := elems[0]
+		elems = elems[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			dest = path.Dir(dest)
+			continue
+		}
+
+		next, info, err := fs.lookup(op, dest, elem)
+		if err != nil {
+			return "", err
+		}
+		if rfs == nil || info.Mode()&os.ModeSymlink == 0 || (len(elems) == 0 && !follow) {
+			dest = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", &os.PathError{Op: op, Path: name, Err: ErrSymlinkLoop}
+		}
+		target, err := rfs.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			dest = "/"
+		}
+		elems = append(strings.Split(target, "/"), elems...)
+	}
+	return dest, nil
+}
+
+// lookup returns the path and info of the entry of dir matching elem.
+func (fs foldFileSystem) lookup(op, dir, elem string) (string, os.FileInfo, error) {
+	name := path.Join(dir, elem)
+	info, err := fs.fs.Lstat(name)
+	if err == nil || !os.IsNotExist(err) {
+		return name, info, err
+	}
+
+	infos, err := fs.fs.Readdir(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	k := fs.opts.key(elem)
+	var matches []os.FileInfo
+	for _, info := range infos {
+		if fs.opts.key(info.Name()) == k {
+			matches = append(matches, info)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	case 1:
+		return path.Join(dir, matches[0].Name()), matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, info := range matches {
+		names[i] = fmt.Sprintf("%q", info.Name())
+	}
+	return "", nil, &os.PathError{Op: op, Path: name, Err: fmt.Errorf("%w: matches %s", ErrAmbiguous, strings.Join(names, ", "))}
+}
+
+func (fs foldFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs foldFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	stored, err := fs.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return OpenContext(ctx, fs.fs, stored)
+}
+
+func (fs foldFileSystem) Lstat(name string) (os.FileInfo, error) {
+	stored, err := fs.resolve("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return fs.fs.Lstat(stored)
+}
+
+func (fs foldFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.StatContext(context.Background(), name)
+}
+
+func (fs foldFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	stored, err := fs.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return StatContext(ctx, fs.fs, stored)
+}
+
+func (fs foldFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs foldFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	stored, err := fs.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return ReaddirContext(ctx, fs.fs, stored)
+}
+
+func (fs foldFileSystem) Readlink(name string) (string, error) {
+	stored, err := fs.resolve("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	return Readlink(fs.fs, stored)
+}
+
+func (fs foldFileSystem) String() string {
+	return fs.fs.String()
+}
+
+// foldRune returns the smallest rune equivalent to r under simple case
+// folding.
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+// Hangul syllables decompose algorithmically.
+const (
+	hangulBase  = 0xAC00
+	hangulCount = 11172
+	jamoLBase   = 0x1100
+	jamoVBase   = 0x1161
+	jamoTBase   = 0x11A7
+	jamoVCount  = 21
+	jamoTCount  = 28
+)
+
+//go:generate go run fold_gen.go
+
+// decompose returns s in Unicode normalization form D, using the tables in
+// fold_tables.go.
+func decompose(s string) string {
+	runes := make([]rune, 0, len(s))
+	for _, r := range s {
+		switch {
+		case decompositions[r] != "":
+			runes = append(runes, []rune(decompositions[r])...)
+		case r >= hangulBase && r < hangulBase+hangulCount:
+			i := r - hangulBase
+			runes = append(runes, jamoLBase+i/(jamoVCount*jamoTCount), jamoVBase+i%(jamoVCount*jamoTCount)/jamoTCount)
+			if t := i % jamoTCount; t != 0 {
+				runes = append(runes, jamoTBase+t)
+			}
+		default:
+			runes = append(runes, r)
+		}
+	}
+
+	// Put combining marks in canonical order.
+	for i := 1; i < len(runes); i++ {
+		for j := i; j > 0; j-- {
+			c := combiningClasses[runes[j]]
+			if c == 0 || combiningClasses[runes[j-1]] <= c {
+				break
+			}
+			runes[j], runes[j-1] = runes[j-1], runes[j]
+		}
+	}
+	return string(runes)
+}
+
+var (
+	_ ContextFileSystem  = foldFileSystem{}
+	_ ReadlinkFileSystem = foldFileSystem{}
+)
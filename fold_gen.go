@@ -0,0 +1,172 @@
+//go:build ignore
+// +build ignore
+
+// This program generates fold_tables.go from the Unicode Character Database.
+// Run it with go generate, or with -ucd to read a local copy of
+// UnicodeData.txt.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const version = "14.0.0"
+
+var (
+	ucd    = flag.String("ucd", "https://www.unicode.org/Public/"+version+"/ucd/UnicodeData.txt", "URL or file name of UnicodeData.txt")
+	output = flag.String("output", "fold_tables.go", "output file name")
+)
+
+func main() {
+	flag.Parse()
+
+	r, err := open(*ucd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+
+	var (
+		decompositions   = make(map[rune][]rune)
+		combiningClasses = make(map[rune]int)
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Split(s.Text(), ";")
+		if len(fields) < 6 {
+			continue
+		}
+		code, err := strconv.ParseUint(fields[0], 16, 32)
+		if err != nil {
+			log.Fatalf("bad code point %q: %v", fields[0], err)
+		}
+		if class, _ := strconv.Atoi(fields[3]); class != 0 {
+			combiningClasses[rune(code)] = class
+		}
+		// Compatibility decompositions start with a <tag>.
+		if d := fields[5]; d != "" && !strings.HasPrefix(d, "<") {
+			for _, f := range strings.Fields(d) {
+				c, err := strconv.ParseUint(f, 16, 32)
+				if err != nil {
+					log.Fatalf("bad decomposition of %s: %v", fields[0], err)
+				}
+				decompositions[rune(code)] = append(decompositions[rune(code)], rune(c))
+			}
+		}
+	}
+	if err = s.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by fold_gen.go from the Unicode %s data. DO NOT EDIT.\n\n", version)
+	fmt.Fprintf(&buf, "package vfs\n\n")
+	fmt.Fprintf(&buf, "// decompositions maps characters to their full canonical decomposition.\n")
+	fmt.Fprintf(&buf, "var decompositions = map[rune]string{\n")
+	var runes []rune
+	for r := range decompositions {
+		runes = append(runes, r)
+	}
+	for i, r := range sortRunes(runes) {
+		fmt.Fprintf(&buf, "0x%04X: %s,", r, quote(decompose(decompositions, r)))
+		buf.WriteString(separator(i, 4))
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+	fmt.Fprintf(&buf, "// combiningClasses maps combining marks to their canonical combining class.\n")
+	fmt.Fprintf(&buf, "var combiningClasses = map[rune]uint8{\n")
+	runes = runes[:0]
+	for r := range combiningClasses {
+		runes = append(runes, r)
+	}
+	for i, r := range sortRunes(runes) {
+		fmt.Fprintf(&buf, "0x%04X: %d,", r, combiningClasses[r])
+		buf.WriteString(separator(i, 6))
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// open opens the URL or file name.
+func open(name string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(name, "http://") && !strings.HasPrefix(name, "https://") {
+		return os.Open(name)
+	}
+	res, err := http.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s: %s", name, res.Status)
+	}
+	return res.Body, nil
+}
+
+// decompose returns the full canonical decomposition of r.
+func decompose(decompositions map[rune][]rune, r rune) []rune {
+	d, ok := decompositions[r]
+	if !ok {
+		return []rune{r}
+	}
+	var full []rune
+	for _, c := range d {
+		full = append(full, decompose(decompositions, c)...)
+	}
+	return full
+}
+
+// sortRunes sorts runes in place and returns them.
+func sortRunes(runes []rune) []rune {
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return runes
+}
+
+// quote returns runes as a Go string literal, escaping all but printable
+// ASCII.
+func quote(runes []rune) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range runes {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7F:
+			b.WriteRune(r)
+		case r > 0xFFFF:
+			fmt.Fprintf(&b, `\U%08X`, r)
+		default:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// separator returns the separator after the i-th entry of a table with n
+// entries per line.
+func separator(i, n int) string {
+	if i%n == n-1 {
+		return "\n"
+	}
+	return " "
+}
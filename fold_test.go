@@ -0,0 +1,111 @@
+package vfs_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+	"textmodes.com/vfs/zipfs"
+)
+
+func TestFold(t *testing.T) {
+	fs := vfs.Fold(mapfs.New(map[string]string{
+		"Docs/Cafe\u0301.TXT":                  "nfd",
+		"Docs/README":                          "upper",
+		"Docs/readme":                          "lower",
+		"Docs/ReadMe.md":                       "md",
+		"Docs/readme.MD":                       "MD",
+		"\u1112\u1161\u11ab\u1100\u1173\u11af": "hangul",
+		"Tie\u0302\u0301ng Vie\u0323\u0302t":   "vietnamese",
+	}), vfs.FoldOptions{Case: true, Normalize: true})
+
+	for name, want := range map[string]string{
+		"/docs/caf\u00e9.txt":   "Cafe\u0301.TXT",
+		"/DOCS/CAF\u00c9.txt":   "Cafe\u0301.TXT",
+		"/Docs/Cafe\u0301.TXT":  "Cafe\u0301.TXT",
+		"/docs/README":          "README",
+		"/docs/readme":          "readme",
+		"/\ud55c\uae00":         "\u1112\u1161\u11ab\u1100\u1173\u11af",
+		"/ti\u1ebfng vi\u1ec7t": "Tie\u0302\u0301ng Vie\u0323\u0302t",
+	} {
+		info, err := fs.Stat(name)
+		if err != nil {
+			t.Errorf("Stat(%q): %v", name, err)
+			continue
+		}
+		if info.Name() != want {
+			t.Errorf("Stat(%q): expected name %q, got %q", name, want, info.Name())
+		}
+	}
+
+	if _, err := fs.Open("/docs/Readme"); !errors.Is(err, vfs.ErrAmbiguous) {
+		t.Errorf("expected ErrAmbiguous, got %v", err)
+	}
+	if _, err := fs.Stat("/docs/missing"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+
+	collisions, err := vfs.FoldCollisions(fs, "/Docs", vfs.FoldOptions{Case: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"README", "readme"}, {"ReadMe.md", "readme.MD"}}
+	if !reflect.DeepEqual(collisions, want) {
+		t.Errorf("expected collisions %q, got %q", want, collisions)
+	}
+}
+
+func TestFoldZip(t *testing.T) {
+	// The names in archives made on macOS are stored as UTF-8 without the
+	// UTF-8 flag.
+	zfs, err := zipfs.Open("testdata/zip/utf8-osx.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := vfs.Fold(zfs, vfs.FoldOptions{Case: true, Normalize: true})
+
+	info, err := fs.Stat("/\u4e16\u754c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\u4e16\u754c"; info.Name() != want {
+		t.Errorf("expected name %q, got %q", want, info.Name())
+	}
+}
+
+func TestFoldSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.Mkdir(filepath.Join(dir, "Data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "Data", "File.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink("DATA/file.TXT", filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+
+	fs := vfs.Fold(vfs.OS(dir), vfs.FoldOptions{Case: true})
+	f, err := fs.Open("/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "data" {
+		t.Errorf("expected %q, got %q", "data", b)
+	}
+}
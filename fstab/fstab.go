@@ -0,0 +1,645 @@
+/*
+Package fstab builds a vfs.Scope from a declarative mount table, and dumps a
+Scope back out as a table.
+
+A table is a list of mounts, in JSON:
+
+	{"mounts": [
+		{"mount": "/", "source": "/srv/www"},
+		{"mount": "/docs", "source": "/srv/docs.zip/manual.tar", "base": "/html", "mode": "after"},
+		{"mount": "/", "type": "map", "files": {"robots.txt": "User-agent: *"}, "mode": "before"}
+	]}
+
+or in TOML:
+
+	[[mounts]]
+	mount = "/"
+	source = "/srv/www"
+
+	[[mounts]]
+	mount = "/docs"
+	source = "/srv/docs.zip/manual.tar"
+	base = "/html"
+	mode = "after"
+
+	[mounts.options]
+	union = "dirs"
+
+The mounts are bound in order. This package is separate from vfs, since it
+opens the archive backends.
+*/
+package fstab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/autofs"
+	"textmodes.com/vfs/mapfs"
+	"textmodes.com/vfs/rarfs"
+	"textmodes.com/vfs/tarfs"
+	"textmodes.com/vfs/zipfs"
+)
+
+// Source types.
+const (
+	TypeOS   = "os"   // a directory on disk
+	TypeAuto = "auto" // a directory or archive on disk, mounted with autofs
+	TypeZip  = "zip"
+	TypeTar  = "tar"
+	TypeRar  = "rar"
+	TypeMap  = "map" // the files of the entry
+)
+
+// Table is a mount table.
+type Table struct {
+	Mounts []Entry `json:"mounts"`
+}
+
+// Entry is a mount of a Table.
+type Entry struct {
+	// Mount is the path the source is mounted at.
+	Mount string `json:"mount"`
+
+	// Type is the type of the source. If empty, it is TypeMap if Files is
+	// set, TypeOS for directories and the archive type for files.
+	Type string `json:"type,omitempty"`
+
+	// Source is the path of the source on disk. For archives, the path may
+	// continue inside of them, to nested archives or directories.
+	Source string `json:"source,omitempty"`
+
+	// Files are the contents of a TypeMap source, by path.
+	Files map[string]string `json:"files,omitempty"`
+
+	// Base is the path in the source that is mounted.
+	Base string `json:"base,omitempty"`
+
+	// Mode is the bind mode: "replace", which is the default, "before" or
+	// "after".
+	Mode string `json:"mode,omitempty"`
+
+	Options Options `json:"options"`
+
+	line int
+}
+
+// Options are the options of an Entry.
+type Options struct {
+	// Union is the union policy of the bind: "merge", which is the
+	// default, "first" or "dirs".
+	Union string `json:"union,omitempty"`
+
+	// Whiteouts enables whiteout markers in the bind.
+	Whiteouts bool `json:"whiteouts,omitempty"`
+
+	// Password is the password of a rar archive.
+	Password string `json:"password,omitempty"`
+}
+
+// Error is an error in a mount table.
+type Error struct {
+	Line int // line of the table, or 0 if unknown
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return "fstab: " + e.Err.Error()
+	}
+	return fmt.Sprintf("fstab: line %d: %v", e.Line, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+var (
+	bindModes = map[string]vfs.BindMode{
+		"":        vfs.BindReplace,
+		"replace": vfs.BindReplace,
+		"before":  vfs.BindBefore,
+		"after":   vfs.BindAfter,
+	}
+	unionPolicies = map[string]vfs.UnionPolicy{
+		"":      vfs.UnionMerge,
+		"merge": vfs.UnionMerge,
+		"first": vfs.UnionFirst,
+		"dirs":  vfs.UnionDirs,
+	}
+)
+
+// LoadMounts reads a mount table in JSON or TOML from r and returns a Scope
+// with its mounts bound.
+func LoadMounts(r io.Reader) (vfs.Scope, error) {
+	table, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return table.Scope()
+}
+
+// Parse reads a mount table in JSON or TOML from r. JSON tables start with
+// "{", anything else is read as TOML.
+func Parse(r io.Reader) (*Table, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseJSON(b)
+	}
+	return parseTOML(b)
+}
+
+// parseJSON parses a table in JSON, recording the line of each entry.
+func parseJSON(b []byte) (*Table, error) {
+	var (
+		table = new(Table)
+		dec   = json.NewDecoder(bytes.NewReader(b))
+	)
+	dec.DisallowUnknownFields()
+	fail := func(offset int64, err error) (*Table, error) {
+		var (
+			syntax *json.SyntaxError
+			typ    *json.UnmarshalTypeError
+		)
+		if errors.As(err, &syntax) {
+			offset = syntax.Offset
+		} else if errors.As(err, &typ) {
+			offset = typ.Offset
+		}
+		return nil, &Error{Line: lineOf(b, offset), Err: err}
+	}
+	expect := func(want json.Delim) error {
+		t, err := dec.Token()
+		if err == nil && t != want {
+			err = fmt.Errorf("expected %q, got %v", want, t)
+		}
+		return err
+	}
+
+	if err := expect('{'); err != nil {
+		return fail(dec.InputOffset(), err)
+	}
+	for dec.More() {
+		offset := dec.InputOffset()
+		key, err := dec.Token()
+		if err != nil {
+			return fail(offset, err)
+		}
+		if key != "mounts" {
+			return fail(offset, fmt.Errorf("unknown field %q", key))
+		}
+		if err = expect('['); err != nil {
+			return fail(dec.InputOffset(), err)
+		}
+		for dec.More() {
+			offset := dec.InputOffset()
+			var e Entry
+			if err = dec.Decode(&e); err != nil {
+				return fail(offset, err)
+			}
+			e.line = lineOf(b, offset)
+			table.Mounts = append(table.Mounts, e)
+		}
+		if err = expect(']'); err != nil {
+			return fail(dec.InputOffset(), err)
+		}
+	}
+	if err := expect('}'); err != nil {
+		return fail(dec.InputOffset(), err)
+	}
+	return table, nil
+}
+
+// lineOf returns the line of the first token at or after offset in b.
+func lineOf(b []byte, offset int64) int {
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	for offset < int64(len(b)) && strings.IndexByte(" \t\r\n,:", b[offset]) >= 0 {
+		offset++
+	}
+	return bytes.Count(b[:offset], []byte("\n")) + 1
+}
+
+// Scope returns a Scope with the mounts of the table bound, in order. If an
+// entry fails, the file systems opened for the earlier ones are closed.
+func (t *Table) Scope() (vfs.Scope, error) {
+	var (
+		scope  = vfs.NewScope()
+		opened []vfs.FileSystem
+	)
+	for _, e := range t.Mounts {
+		if err := e.bind(scope, &opened); err != nil {
+			closeAll(opened)
+			return nil, &Error{Line: e.line, Err: err}
+		}
+	}
+	return scope, nil
+}
+
+// closeAll closes the file systems that implement io.Closer, last opened
+// first.
+func closeAll(fss []vfs.FileSystem) {
+	for i := len(fss) - 1; i >= 0; i-- {
+		if c, ok := fss[i].(io.Closer); ok {
+			c.Close()
+		}
+	}
+}
+
+// bind binds the entry in scope, adding the file systems it opens to opened.
+func (e Entry) bind(scope vfs.Scope, opened *[]vfs.FileSystem) error {
+	if e.Mount == "" {
+		return errors.New("missing mount point")
+	}
+	mode, ok := bindModes[e.Mode]
+	if !ok {
+		return fmt.Errorf("unknown bind mode %q", e.Mode)
+	}
+	union, ok := unionPolicies[e.Options.Union]
+	if !ok {
+		return fmt.Errorf("unknown union policy %q", e.Options.Union)
+	}
+
+	fs, base, err := e.open(opened)
+	if err != nil {
+		return err
+	}
+	scope.BindWith(e.Mount, path.Join(base, e.Base), newSource(fs, e, base), mode, vfs.BindOptions{
+		Union:     union,
+		Whiteouts: e.Options.Whiteouts,
+	})
+	return nil
+}
+
+// open opens the source of the entry, and returns the path of the source in
+// the file system. The file systems it opens, including the archives
+// containing nested ones, are added to opened.
+func (e Entry) open(opened *[]vfs.FileSystem) (vfs.FileSystem, string, error) {
+	switch {
+	case e.Type == TypeMap || (e.Type == "" && e.Files != nil):
+		if e.Source != "" {
+			return nil, "", errors.New("map mount with a source")
+		}
+		fs := mapfs.New(e.Files)
+		*opened = append(*opened, fs)
+		return fs, "/", nil
+	case e.Source == "":
+		return nil, "", errors.New("missing source")
+	case e.Type == TypeAuto:
+		fs, err := autofs.New(e.Source)
+		if err != nil {
+			return nil, "", err
+		}
+		*opened = append(*opened, fs)
+		return fs, "/", nil
+	}
+
+	// Find the part of the source on disk.
+	name := filepath.Clean(e.Source)
+	var rest []string
+	info, err := os.Stat(name)
+	for err != nil && filepath.Dir(name) != name && (os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR)) {
+		rest = append([]string{filepath.Base(name)}, rest...)
+		name = filepath.Dir(name)
+		info, err = os.Stat(name)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if info.IsDir() {
+		if len(rest) > 0 {
+			return nil, "", &os.PathError{Op: "open", Path: e.Source, Err: os.ErrNotExist}
+		}
+		if e.Type != "" && e.Type != TypeOS {
+			return nil, "", fmt.Errorf("%s is a directory, not %s", name, e.Type)
+		}
+		fs := vfs.OS(name)
+		*opened = append(*opened, fs)
+		return fs, "/", nil
+	}
+
+	typ := e.Type
+	if typ == "" {
+		typ = archiveType(name)
+	}
+	fs, err := openArchive(typ, nil, name, e.Options.Password)
+	if err != nil {
+		return nil, "", err
+	}
+	*opened = append(*opened, fs)
+
+	// Descend into the archive, opening nested archives.
+	base := "/"
+	for _, elem := range rest {
+		base = path.Join(base, elem)
+		info, err := fs.Stat(base)
+		if err != nil {
+			return nil, "", err
+		}
+		if typ := archiveType(elem); !info.IsDir() && typ != "" {
+			if fs, err = openArchive(typ, fs, base, e.Options.Password); err != nil {
+				return nil, "", err
+			}
+			*opened = append(*opened, fs)
+			base = "/"
+		}
+	}
+	return fs, base, nil
+}
+
+// archiveType returns the type of the archive name by its extension, or
+// empty if it isn't one.
+func archiveType(name string) string {
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".zip", ".tar", ".rar":
+		return ext[1:]
+	default:
+		return ""
+	}
+}
+
+// openArchive opens the archive name of typ, on disk if parent is nil.
+func openArchive(typ string, parent vfs.FileSystem, name, password string) (vfs.FileSystem, error) {
+	switch {
+	case typ == TypeZip && parent == nil:
+		return zipfs.Open(name)
+	case typ == TypeZip:
+		return zipfs.OpenFile(parent, name)
+	case typ == TypeTar && parent == nil:
+		return tarfs.Open(name)
+	case typ == TypeTar:
+		return tarfs.OpenFile(parent, name)
+	case typ == TypeRar && parent == nil:
+		return rarfs.Open(name, password)
+	case typ == TypeRar:
+		return rarfs.OpenFile(parent, name, password)
+	case typ == "":
+		return nil, &os.PathError{Op: "open", Path: name, Err: vfs.ErrNotSupported}
+	default:
+		return nil, fmt.Errorf("unknown source type %q", typ)
+	}
+}
+
+// Dump writes the mounts of scope to w as a table in format, "json" or
+// "toml". The scope may only contain mounts bound by this package, and the
+// empty root directory of vfs.NewScope. The passwords of archives are left
+// out of the table.
+func Dump(w io.Writer, scope vfs.Scope, format string) error {
+	table, err := tableOf(scope)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(table)
+	case "toml":
+		return writeTOML(w, table)
+	default:
+		return fmt.Errorf("fstab: unknown format %q", format)
+	}
+}
+
+// tableOf returns the table of the mounts of scope.
+func tableOf(scope vfs.Scope) (*Table, error) {
+	var (
+		table  = new(Table)
+		mounts = scope.Mounts() // by root, parents first
+	)
+	for i := 0; i < len(mounts); {
+		j := i
+		for j < len(mounts) && mounts[j].Root == mounts[i].Root {
+			j++
+		}
+		entries, err := entriesOf(mounts[i:j])
+		if err != nil {
+			return nil, err
+		}
+		table.Mounts = append(table.Mounts, entries...)
+		i = j
+	}
+	return table, nil
+}
+
+// entriesOf returns the entries binding the mounts of a mount point, in the
+// order they must be bound in.
+func entriesOf(mounts []vfs.Mount) ([]Entry, error) {
+	var (
+		before, after []Entry
+		inherited     bool
+	)
+	for _, m := range mounts {
+		if m.Inherited {
+			inherited = true
+			continue
+		}
+		o, ok := m.FileSystem.(interface{ origin() *source })
+		if !ok {
+			if m.Root == "/" && m.FS == "empty(/)" {
+				inherited = true // bind after it
+				continue
+			}
+			return nil, fmt.Errorf("fstab: can't dump %s mounted at %s", m.FS, m.Root)
+		}
+
+		src := o.origin()
+		e := src.entry
+		e.Mount = m.Root
+		e.Options.Password = ""
+		e.Base = m.Base
+		if src.base != "/" {
+			e.Base = strings.TrimPrefix(m.Base, src.base)
+		}
+		if e.Base == "/" {
+			e.Base = ""
+		}
+		e.Options.Union = ""
+		for name, policy := range unionPolicies {
+			if name != "" && policy == m.Options.Union && policy != vfs.UnionMerge {
+				e.Options.Union = name
+			}
+		}
+		e.Options.Whiteouts = m.Options.Whiteouts
+
+		if inherited {
+			e.Mode = "after"
+			after = append(after, e)
+		} else {
+			e.Mode = "before"
+			before = append(before, e)
+		}
+	}
+
+	// Without inherited mounts, the first mount replaces the mounts of the
+	// parent. Mounts before inherited ones are bound in reverse.
+	var entries []Entry
+	if !inherited && len(before) > 0 {
+		before[0].Mode = ""
+		for _, e := range before[1:] {
+			e.Mode = "after"
+			after = append(after, e)
+		}
+		before = before[:1]
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		entries = append(entries, before[i])
+	}
+	return append(entries, after...), nil
+}
+
+// source is a file system opened for an Entry.
+type source struct {
+	vfs.FileSystem
+	entry Entry
+	base  string // path of the source in the file system
+}
+
+// overlayFileSystem is the interface of autofs.
+type overlayFileSystem interface {
+	vfs.MountFileSystem
+	vfs.OverlayFileSystem
+	vfs.TracerFileSystem
+	vfs.WriteFileSystem
+}
+
+// newSource returns fs as the source of e. The source implements the optional
+// interfaces of the file systems entries open: vfs.WriteFileSystem for
+// directories, those of autofs, and vfs.TracerFileSystem for archives.
+func newSource(fs vfs.FileSystem, e Entry, base string) vfs.FileSystem {
+	src := &source{fs, e, base}
+	switch fs := fs.(type) {
+	case overlayFileSystem:
+		return &overlaySource{&writeSource{src, fs}, fs}
+	case vfs.WriteFileSystem:
+		return &writeSource{src, fs}
+	case vfs.TracerFileSystem:
+		return &tracerSource{src, fs}
+	}
+	return src
+}
+
+// origin returns the source, for the source types embedding it.
+func (fs *source) origin() *source {
+	return fs
+}
+
+func (fs *source) OpenContext(ctx context.Context, name string) (vfs.ReadSeekCloser, error) {
+	return vfs.OpenContext(ctx, fs.FileSystem, name)
+}
+
+func (fs *source) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	return vfs.StatContext(ctx, fs.FileSystem, name)
+}
+
+func (fs *source) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	return vfs.ReaddirContext(ctx, fs.FileSystem, name)
+}
+
+func (fs *source) Readlink(name string) (string, error) {
+	return vfs.Readlink(fs.FileSystem, name)
+}
+
+// writeSource is a source of a vfs.WriteFileSystem.
+type writeSource struct {
+	*source
+	fs vfs.WriteFileSystem
+}
+
+func (fs *writeSource) Create(name string) (vfs.ReadWriteSeekCloser, error) {
+	return fs.fs.Create(name)
+}
+
+func (fs *writeSource) OpenFile(name string, flag int, perm os.FileMode) (vfs.ReadWriteSeekCloser, error) {
+	return fs.fs.OpenFile(name, flag, perm)
+}
+
+func (fs *writeSource) Mkdir(name string, perm os.FileMode) error {
+	return fs.fs.Mkdir(name, perm)
+}
+
+func (fs *writeSource) MkdirAll(name string, perm os.FileMode) error {
+	return fs.fs.MkdirAll(name, perm)
+}
+
+func (fs *writeSource) Remove(name string) error {
+	return fs.fs.Remove(name)
+}
+
+func (fs *writeSource) RemoveAll(name string) error {
+	return fs.fs.RemoveAll(name)
+}
+
+func (fs *writeSource) Rename(oldname, newname string) error {
+	return fs.fs.Rename(oldname, newname)
+}
+
+func (fs *writeSource) Chmod(name string, mode os.FileMode) error {
+	return fs.fs.Chmod(name, mode)
+}
+
+func (fs *writeSource) Chtimes(name string, atime, mtime time.Time) error {
+	return fs.fs.Chtimes(name, atime, mtime)
+}
+
+// tracerSource is a source of a vfs.TracerFileSystem, such as an archive.
+type tracerSource struct {
+	*source
+	fs vfs.TracerFileSystem
+}
+
+func (fs *tracerSource) Tracer() vfs.Tracer {
+	return fs.fs.Tracer()
+}
+
+func (fs *tracerSource) SetTracer(t vfs.Tracer) {
+	fs.fs.SetTracer(t)
+}
+
+// overlaySource is a source of autofs.
+type overlaySource struct {
+	*writeSource
+	fs overlayFileSystem
+}
+
+func (fs *overlaySource) Locate(name string) (vfs.FileSystem, string, bool) {
+	return fs.fs.Locate(name)
+}
+
+func (fs *overlaySource) WrapOverlays(wrap func(name string, fs vfs.FileSystem) vfs.FileSystem) {
+	fs.fs.WrapOverlays(wrap)
+}
+
+func (fs *overlaySource) Tracer() vfs.Tracer {
+	return fs.fs.Tracer()
+}
+
+func (fs *overlaySource) SetTracer(t vfs.Tracer) {
+	fs.fs.SetTracer(t)
+}
+
+var (
+	_ vfs.ContextFileSystem  = (*source)(nil)
+	_ vfs.ReadlinkFileSystem = (*source)(nil)
+	_ vfs.WriteFileSystem    = (*writeSource)(nil)
+	_ vfs.ContextFileSystem  = (*writeSource)(nil)
+	_ vfs.TracerFileSystem   = (*tracerSource)(nil)
+	_ vfs.ContextFileSystem  = (*tracerSource)(nil)
+	_ overlayFileSystem      = (*overlaySource)(nil)
+	_ vfs.ContextFileSystem  = (*overlaySource)(nil)
+)
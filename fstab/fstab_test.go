@@ -0,0 +1,310 @@
+package fstab
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"textmodes.com/vfs"
+)
+
+// testSources creates a directory and a zip file containing a tar file in
+// a temporary directory, and returns its path.
+func testSources(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "vfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, "www", "css"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"www/index.html":   "index",
+		"www/css/site.css": "site",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var inner bytes.Buffer
+	tw := tar.NewWriter(&inner)
+	for name, data := range map[string]string{
+		"html/manual.html": "manual",
+		"html/intro.html":  "intro",
+	} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(data))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var outer bytes.Buffer
+	zw := zip.NewWriter(&outer)
+	w, err := zw.Create("manual.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(inner.Bytes())
+	if err = zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "docs.zip"), outer.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func readFile(t *testing.T, fs vfs.FileSystem, name string) string {
+	t.Helper()
+	f, err := fs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func readdirNames(t *testing.T, fs vfs.FileSystem, name string) []string {
+	t.Helper()
+	infos, err := fs.Readdir(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLoadMounts(t *testing.T) {
+	dir := testSources(t)
+	defer os.RemoveAll(dir)
+	dir = filepath.ToSlash(dir)
+	tables := map[string]string{
+		"json": `{
+	"mounts": [
+		{"mount": "/", "source": "` + dir + `/www"},
+		{"mount": "/docs", "source": "` + dir + `/docs.zip/manual.tar", "base": "/html"},
+		{"mount": "/", "files": {"robots.txt": "User-agent: *"}, "mode": "before", "options": {"union": "dirs"}}
+	]
+}`,
+		"toml": `# test table
+[[mounts]]
+mount = "/"
+source = "` + dir + `/www"
+
+[[mounts]]
+mount = '/docs'
+source = "` + dir + `/docs.zip/manual.tar"
+base = "/html" # in the tar
+
+[[mounts]]
+mount = "/"
+mode = "before"
+
+[mounts.options]
+union = "dirs"
+
+[mounts.files]
+"robots.txt" = "User-agent: *"
+`,
+	}
+	for format, table := range tables {
+		t.Run(format, func(t *testing.T) {
+			scope, err := LoadMounts(strings.NewReader(table))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range map[string]string{
+				"/index.html":       "index",
+				"/css/site.css":     "site",
+				"/robots.txt":       "User-agent: *",
+				"/docs/manual.html": "manual",
+			} {
+				if got := readFile(t, scope, name); got != want {
+					t.Errorf("%s: expected %q, got %q", name, want, got)
+				}
+			}
+			if got, want := readdirNames(t, scope, "/docs"), []string{"intro.html", "manual.html"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestLoadMountsErrors(t *testing.T) {
+	dir := testSources(t)
+	defer os.RemoveAll(dir)
+	dir = filepath.ToSlash(dir)
+	tests := []struct {
+		table string
+		line  int
+		err   error
+	}{
+		{"{\n\"mounts\": [\n{\"mount\": \"/\", \"source\": \"" + dir + "/www\"},\n{\"mount\": \"/\", \"source\": \"" + dir + "/missing\"}\n]}", 4, os.ErrNotExist},
+		{"{\n\"mounts\": [\n{\"mount\": \"/\",\n\"sauce\": \"/\"}\n]}", 3, nil},
+		{"{\n\"mounts\": [\n{\"mount\": \"/\", \"source\": \"" + dir + "/www\", \"mode\": \"sideways\"}\n]}", 3, nil},
+		{"{\n\"mounts\": [\n{\"mount\": \"/\"\n\"source\": \"/\"}\n]}", 4, nil},
+		{"[[mounts]]\nmount = \"/\"\nsource = \"" + dir + "/docs.zip/missing.tar\"\n", 1, os.ErrNotExist},
+		{"[[mounts]]\nmount = \"/\"\nsource = \"" + dir + "/www\"\n\n[mounts.options]\nunion = \"all\"\n", 1, nil},
+		{"[[mounts]]\nmount = \"/\"\nsource = \"" + dir + "/www\n", 3, nil},
+		{"[[mounts]]\nmount = \"/\"\nmount = \"/\"\n", 3, nil},
+		{"[[mounts]]\nmount = \"/\"\n[mounts.other]\n", 3, nil},
+		{"mount = \"/\"\n", 1, nil},
+	}
+	for _, test := range tests {
+		_, err := LoadMounts(strings.NewReader(test.table))
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%q: expected *Error, got %v", test.table, err)
+			continue
+		}
+		if e.Line != test.line {
+			t.Errorf("%q: expected line %d, got %d (%v)", test.table, test.line, e.Line, err)
+		}
+		if test.err != nil && !errors.Is(err, test.err) {
+			t.Errorf("%q: expected %v, got %v", test.table, test.err, err)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	dir := testSources(t)
+	defer os.RemoveAll(dir)
+	dir = filepath.ToSlash(dir)
+	table := `[[mounts]]
+mount = "/"
+source = "` + dir + `/www"
+
+[[mounts]]
+mount = "/docs"
+source = "` + dir + `/docs.zip/manual.tar"
+base = "/html"
+mode = "after"
+
+[[mounts]]
+mount = "/extra"
+mode = "before"
+
+[mounts.options]
+union = "first"
+whiteouts = true
+
+[mounts.files]
+"a \"b\".txt" = "c"
+`
+	scope, err := LoadMounts(strings.NewReader(table))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"json", "toml"} {
+		var buf bytes.Buffer
+		if err := Dump(&buf, scope, format); err != nil {
+			t.Fatal(err)
+		}
+		again, err := LoadMounts(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", format, err, buf.Bytes())
+		}
+		if got, want := mounts(again), mounts(scope); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v\n%s", format, want, got, buf.Bytes())
+		}
+		if format == "toml" && buf.String() != table {
+			t.Errorf("expected\n%s\ngot\n%s", table, buf.Bytes())
+		}
+	}
+
+	scope.Bind("/other", "/", vfs.OS(dir), vfs.BindReplace)
+	if err = Dump(ioutil.Discard, scope, "json"); err == nil {
+		t.Error("expected an error dumping a foreign mount")
+	}
+}
+
+func TestDumpPassword(t *testing.T) {
+	dir := testSources(t)
+	defer os.RemoveAll(dir)
+	scope, err := LoadMounts(strings.NewReader(`{"mounts": [
+		{"mount": "/", "source": "` + filepath.ToSlash(dir) + `/docs.zip", "options": {"password": "secret"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []string{"json", "toml"} {
+		var buf bytes.Buffer
+		if err := Dump(&buf, scope, format); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), "secret") {
+			t.Errorf("%s: expected the password to be left out, got\n%s", format, buf.Bytes())
+		}
+	}
+}
+
+func TestSourceInterfaces(t *testing.T) {
+	dir := testSources(t)
+	defer os.RemoveAll(dir)
+	dir = filepath.ToSlash(dir)
+	scope, err := LoadMounts(strings.NewReader(`{"mounts": [
+		{"mount": "/", "source": "` + dir + `/www"},
+		{"mount": "/docs", "source": "` + dir + `/docs.zip"},
+		{"mount": "/auto", "type": "auto", "source": "` + dir + `"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range scope.Mounts() {
+		var ok bool
+		switch m.Root {
+		case "/":
+			_, ok = m.FileSystem.(vfs.WriteFileSystem)
+		case "/docs":
+			_, ok = m.FileSystem.(vfs.TracerFileSystem)
+		case "/auto":
+			_, ok = m.FileSystem.(vfs.OverlayFileSystem)
+		default:
+			continue
+		}
+		if !ok {
+			t.Errorf("%s: the source of %s hides its interfaces", m.Root, m.FS)
+		}
+	}
+
+	// The directory on disk is writable through the scope.
+	f, err := scope.Create("/new.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err = os.Stat(filepath.Join(dir, "www", "new.txt")); err != nil {
+		t.Error(err)
+	}
+}
+
+// mounts returns the mounts of scope without their file systems.
+func mounts(scope vfs.Scope) []vfs.Mount {
+	ms := scope.Mounts()
+	for i := range ms {
+		ms[i].FileSystem = nil
+	}
+	return ms
+}
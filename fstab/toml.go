@@ -0,0 +1,314 @@
+package fstab
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses a table in the subset of TOML used by mount tables: an
+// array of [[mounts]] tables with string and boolean values, and their
+// [mounts.options] and [mounts.files] sub-tables.
+func parseTOML(b []byte) (*Table, error) {
+	var (
+		table   = new(Table)
+		section string
+		seen    map[string]bool
+	)
+	for i, line := range strings.Split(string(b), "\n") {
+		fail := func(format string, args ...interface{}) (*Table, error) {
+			return nil, &Error{Line: i + 1, Err: fmt.Errorf(format, args...)}
+		}
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case line == "[[mounts]]":
+			table.Mounts = append(table.Mounts, Entry{line: i + 1})
+			section, seen = "", make(map[string]bool)
+			continue
+		case strings.HasPrefix(line, "["):
+			if len(table.Mounts) == 0 {
+				return fail("table %s outside of [[mounts]]", line)
+			}
+			switch line {
+			case "[mounts.options]":
+				section = "options"
+			case "[mounts.files]":
+				section = "files"
+			default:
+				return fail("unknown table %s", line)
+			}
+			if seen["["+section+"]"] {
+				return fail("duplicate table %s", line)
+			}
+			seen["["+section+"]"] = true
+			continue
+		case len(table.Mounts) == 0:
+			return fail("key outside of [[mounts]]")
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return fail("expected key = value")
+		}
+		key, err := parseKey(strings.TrimSpace(line[:eq]))
+		if err != nil {
+			return fail("%v", err)
+		}
+		value, rest, err := parseValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return fail("%v", err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return fail("unexpected %q after value", rest)
+		}
+		if seen[section+"."+key] {
+			return fail("duplicate key %q", key)
+		}
+		seen[section+"."+key] = true
+
+		e := &table.Mounts[len(table.Mounts)-1]
+		if err = e.set(section, key, value); err != nil {
+			return fail("%v", err)
+		}
+	}
+	return table, nil
+}
+
+// set sets the key in section of the entry to value.
+func (e *Entry) set(section, key string, value interface{}) error {
+	if section == "files" {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("files value %q is not a string", key)
+		}
+		if e.Files == nil {
+			e.Files = make(map[string]string)
+		}
+		e.Files[key] = s
+		return nil
+	}
+
+	var (
+		strs = map[string]*string{
+			".mount":           &e.Mount,
+			".type":            &e.Type,
+			".source":          &e.Source,
+			".base":            &e.Base,
+			".mode":            &e.Mode,
+			"options.union":    &e.Options.Union,
+			"options.password": &e.Options.Password,
+		}
+		bools = map[string]*bool{
+			"options.whiteouts": &e.Options.Whiteouts,
+		}
+		name = section + "." + key
+	)
+	if p, ok := strs[name]; ok {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s is not a string", key)
+		}
+		*p = s
+		return nil
+	}
+	if p, ok := bools[name]; ok {
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("%s is not a boolean", key)
+		}
+		*p = b
+		return nil
+	}
+	return fmt.Errorf("unknown field %q", key)
+}
+
+// stripComment removes a comment from line, outside of strings.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == 0 && c == '#':
+			return line[:i]
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return line
+}
+
+// parseKey parses a bare or quoted key.
+func parseKey(s string) (string, error) {
+	if s == "" {
+		return "", errors.New("empty key")
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		key, rest, err := parseString(s)
+		if err == nil && rest != "" {
+			err = fmt.Errorf("invalid key %s", s)
+		}
+		return key, err
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return "", fmt.Errorf("invalid key %s", s)
+		}
+	}
+	return s, nil
+}
+
+// parseValue parses a string or boolean at the start of s, and returns the
+// rest of s.
+func parseValue(s string) (interface{}, string, error) {
+	switch {
+	case strings.HasPrefix(s, "true"):
+		return true, s[4:], nil
+	case strings.HasPrefix(s, "false"):
+		return false, s[5:], nil
+	case strings.HasPrefix(s, `"`), strings.HasPrefix(s, "'"):
+		return parseString(s)
+	case s == "":
+		return nil, "", errors.New("missing value")
+	default:
+		return nil, "", fmt.Errorf("unsupported value %s", s)
+	}
+}
+
+// parseString parses a basic or literal string at the start of s, and returns
+// the rest of s.
+func parseString(s string) (string, string, error) {
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", errors.New("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+
+	var buf strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return buf.String(), s[i+1:], nil
+		case '\\':
+			if i+1 == len(s) {
+				return "", "", errors.New("unterminated string")
+			}
+			i++
+			switch c := s[i]; c {
+			case 'b':
+				buf.WriteByte('\b')
+			case 't':
+				buf.WriteByte('\t')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'r':
+				buf.WriteByte('\r')
+			case '"', '\\':
+				buf.WriteByte(c)
+			case 'u', 'U':
+				n := 4
+				if c == 'U' {
+					n = 8
+				}
+				if i+n >= len(s) {
+					return "", "", errors.New("invalid escape in string")
+				}
+				r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", "", errors.New("invalid escape in string")
+				}
+				buf.WriteRune(rune(r))
+				i += n
+			default:
+				return "", "", fmt.Errorf("invalid escape \\%c in string", c)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", "", errors.New("unterminated string")
+}
+
+// writeTOML writes table to w in TOML.
+func writeTOML(w io.Writer, table *Table) error {
+	var (
+		buf bytes.Buffer
+		put = func(key, value string) {
+			if value != "" {
+				fmt.Fprintf(&buf, "%s = %s\n", key, quote(value))
+			}
+		}
+	)
+	for i, e := range table.Mounts {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString("[[mounts]]\n")
+		put("mount", e.Mount)
+		put("type", e.Type)
+		put("source", e.Source)
+		put("base", e.Base)
+		put("mode", e.Mode)
+
+		if e.Options != (Options{}) {
+			buf.WriteString("\n[mounts.options]\n")
+			put("union", e.Options.Union)
+			if e.Options.Whiteouts {
+				buf.WriteString("whiteouts = true\n")
+			}
+			put("password", e.Options.Password)
+		}
+
+		if len(e.Files) > 0 {
+			buf.WriteString("\n[mounts.files]\n")
+			names := make([]string, 0, len(e.Files))
+			for name := range e.Files {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(&buf, "%s = %s\n", quote(name), quote(e.Files[name]))
+			}
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// quote returns s as a TOML basic string.
+func quote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\u%04X`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,147 @@
+package vfs
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Match reports whether name matches the shell pattern. The pattern syntax is
+// that of path.Match, with the addition of a "**" path element that matches
+// zero or more directories. The only possible returned error is
+// path.ErrBadPattern, when pattern is malformed.
+func Match(pattern, name string) (matched bool, err error) {
+	patterns := splitPattern(pattern)
+	if err = checkPattern(patterns); err != nil {
+		return false, err
+	}
+	return matchElems(patterns, splitPattern(name)), nil
+}
+
+// Glob returns the names of all files in fs matching pattern, or nil if there
+// is no matching file. The syntax of patterns is the same as in Match. Since
+// directories are expanded using Readdir, Glob descends into any mounts of a
+// Scope or archives presented as directories. Symbolic links are not
+// followed by "**". The result is sorted.
+//
+// Glob ignores file system errors such as I/O errors reading directories.
+// The only possible returned error is path.ErrBadPattern, when pattern is
+// malformed.
+func Glob(fs FileSystem, pattern string) (matches []string, err error) {
+	patterns := splitPattern(pattern)
+	if err = checkPattern(patterns); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	glob(fs, "/", patterns, seen)
+	if len(seen) == 0 {
+		return nil, nil
+	}
+
+	for name := range seen {
+		matches = append(matches, name)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// glob adds the names below dir matching patterns to seen.
+func glob(fs FileSystem, dir string, patterns []string, seen map[string]bool) {
+	if len(patterns) == 0 {
+		seen[dir] = true
+		return
+	}
+
+	pattern := patterns[0]
+	if !hasMeta(pattern) {
+		name := path.Join(dir, pattern)
+		if _, err := fs.Lstat(name); err == nil {
+			glob(fs, name, patterns[1:], seen)
+		}
+		return
+	}
+
+	infos, err := fs.Readdir(dir)
+	if err != nil {
+		return
+	}
+
+	if pattern == "**" {
+		// Match zero directories, then one or more.
+		glob(fs, dir, patterns[1:], seen)
+		for _, info := range infos {
+			name := path.Join(dir, path.Base(info.Name()))
+			if isDir(info) {
+				glob(fs, name, patterns, seen)
+			} else if len(patterns) == 1 {
+				// A trailing "**" matches files at any depth too.
+				seen[name] = true
+			}
+		}
+		return
+	}
+
+	for _, info := range infos {
+		name := path.Base(info.Name())
+		if len(patterns) > 1 && !isDir(info) {
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			glob(fs, path.Join(dir, name), patterns[1:], seen)
+		}
+	}
+}
+
+// matchElems matches the path elements in name against patterns.
+func matchElems(patterns, name []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(patterns[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(patterns[0], name[0]); !matched {
+			return false
+		}
+		patterns, name = patterns[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// checkPattern verifies that all elements of a pattern are well formed.
+func checkPattern(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitPattern splits a rooted pattern or name into path elements.
+func splitPattern(pattern string) []string {
+	pattern = strings.Trim(path.Clean("/"+pattern), "/")
+	if pattern == "" {
+		return nil
+	}
+	return strings.Split(pattern, "/")
+}
+
+// hasMeta reports whether pattern contains any of the magic characters
+// recognized by path.Match.
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// isDir reports whether info is a directory, ignoring symbolic links.
+func isDir(info os.FileInfo) bool {
+	return info.IsDir() && info.Mode()&os.ModeSymlink == 0
+}
@@ -0,0 +1,102 @@
+package vfs_test
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/autofs"
+	"textmodes.com/vfs/mapfs"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"/a/*.txt", "/a/b.txt", true},
+		{"/a/*.txt", "/a/b/c.txt", false},
+		{"/a/**/*.txt", "/a/b.txt", true},
+		{"/a/**/*.txt", "/a/b/c/d.txt", true},
+		{"/**", "/a/b/c", true},
+		{"/**/c", "/c", true},
+		{"/**/c", "/a/b", false},
+		{"a/**/b/**/c", "/a/x/b/y/z/c", true},
+		{"/a/**", "/b", false},
+	}
+	for _, test := range tests {
+		got, err := vfs.Match(test.pattern, test.name)
+		if err != nil {
+			t.Errorf("Match(%q, %q): %v", test.pattern, test.name, err)
+		} else if got != test.want {
+			t.Errorf("Match(%q, %q): expected %t, got %t", test.pattern, test.name, test.want, got)
+		}
+	}
+
+	if _, err := vfs.Match("/[", "/a"); err != path.ErrBadPattern {
+		t.Errorf("expected %v, got %v", path.ErrBadPattern, err)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	fs, err := autofs.New("testdata/zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"/unix.zip/**/bar", []string{"/unix.zip/dir/bar"}},
+		{"/te*.zip/*.txt", []string{"/test-trailing-junk.zip/test.txt", "/test.zip/test.txt"}},
+		{"/**/gopher*", []string{"/test-trailing-junk.zip/gophercolor16x16.png", "/test.zip/gophercolor16x16.png"}},
+		{"/missing/**", nil},
+	}
+	for _, test := range tests {
+		got, err := vfs.Glob(fs, test.pattern)
+		if err != nil {
+			t.Errorf("Glob(%q): %v", test.pattern, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Glob(%q): expected %q, got %q", test.pattern, test.want, got)
+		}
+	}
+}
+
+func TestGlobTrailingStars(t *testing.T) {
+	fs := mapfs.New(map[string]string{
+		"pub/f":       "f",
+		"pub/sub/g":   "g",
+		"pub/sub/x/h": "h",
+		"other/i":     "i",
+	})
+
+	// Glob returns exactly the names Match accepts.
+	for _, pattern := range []string{"/pub/**", "/**", "/pub/sub/**"} {
+		var want []string
+		err := vfs.Walk(fs, "/", func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if ok, _ := vfs.Match(pattern, name); ok {
+				want = append(want, name)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(want)
+
+		got, err := vfs.Glob(fs, pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Glob(%q): expected %q, got %q", pattern, want, got)
+		}
+	}
+}
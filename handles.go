@@ -0,0 +1,268 @@
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handle is a file handle recorded by TrackHandles.
+type Handle struct {
+	// Path is the name the handle was opened with.
+	Path string
+
+	// FS is the file system the handle was opened on, or empty for
+	// internal handles, such as the readers of archives opened by the
+	// backends.
+	FS string
+
+	// Opened is the time the handle was opened.
+	Opened time.Time
+
+	// Stack is the stack trace of the goroutine that opened the handle.
+	Stack string
+}
+
+func (h Handle) String() string {
+	fs := h.FS
+	if fs == "" {
+		fs = "internal"
+	}
+	return fmt.Sprintf("%s (%s) opened at %s\n%s", h.Path, fs, h.Opened.Format(time.RFC3339Nano), h.Stack)
+}
+
+// TrackedFileSystem is a FileSystem tracking its open handles, see
+// TrackHandles.
+type TrackedFileSystem interface {
+	ContextFileSystem
+
+	// OpenHandles returns the handles that haven't been closed yet,
+	// oldest first.
+	OpenHandles() []Handle
+
+	// Report writes the open handles to w: first the handles opened on
+	// the file system, then the internal handles, which are open as long
+	// as the files of archives opened through them are.
+	Report(w io.Writer) error
+
+	// Close stops recording internal handles. The handles opened on the
+	// file system are still recorded.
+	Close() error
+}
+
+// TrackHandles returns a FileSystem that records the path and stack trace of
+// every file opened on fs until it is closed, to find leaked handles. The
+// internal handles the backends open until the tracker is closed are
+// recorded as well, regardless of the file system they belong to.
+func TrackHandles(fs FileSystem) TrackedFileSystem {
+	t := &trackedFileSystem{
+		fs:   fs,
+		open: make(map[int]Handle),
+	}
+	trackers.Lock()
+	trackers.list = append(trackers.list, t)
+	trackers.Unlock()
+	return t
+}
+
+// trackers are the trackers internal handles are registered with.
+var trackers struct {
+	sync.Mutex
+	list []*trackedFileSystem
+}
+
+// TrackHandle registers an internal handle of name, such as the reader of an
+// archive opened by a backend, with the trackers created by TrackHandles. It
+// returns the function to call when the handle is closed.
+func TrackHandle(name string) (closed func()) {
+	trackers.Lock()
+	list := trackers.list
+	trackers.Unlock()
+	if len(list) == 0 {
+		return func() {}
+	}
+
+	h := newHandle("", name)
+	ids := make([]int, len(list))
+	for i, t := range list {
+		ids[i] = t.add(h)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			for i, t := range list {
+				t.remove(ids[i])
+			}
+		})
+	}
+}
+
+// newHandle returns a Handle for name opened on fs by the caller of the
+// caller of newHandle.
+func newHandle(fs, name string) Handle {
+	pc := make([]uintptr, 32)
+	n := runtime.Callers(3, pc)
+	frames := runtime.CallersFrames(pc[:n])
+
+	var stack strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&stack, "\t%s\n\t\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return Handle{
+		Path:   name,
+		FS:     fs,
+		Opened: time.Now(),
+		Stack:  stack.String(),
+	}
+}
+
+type trackedFileSystem struct {
+	fs FileSystem
+
+	mu   sync.Mutex
+	next int
+	open map[int]Handle
+}
+
+// add records h as open and returns its id.
+func (fs *trackedFileSystem) add(h Handle) int {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.next++
+	fs.open[fs.next] = h
+	return fs.next
+}
+
+// remove records the handle with id as closed.
+func (fs *trackedFileSystem) remove(id int) {
+	fs.mu.Lock()
+	delete(fs.open, id)
+	fs.mu.Unlock()
+}
+
+func (fs *trackedFileSystem) OpenHandles() []Handle {
+	fs.mu.Lock()
+	ids := make([]int, 0, len(fs.open))
+	for id := range fs.open {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	handles := make([]Handle, len(ids))
+	for i, id := range ids {
+		handles[i] = fs.open[id]
+	}
+	fs.mu.Unlock()
+	return handles
+}
+
+func (fs *trackedFileSystem) Report(w io.Writer) error {
+	var handles, internal []Handle
+	for _, h := range fs.OpenHandles() {
+		if h.FS == "" {
+			internal = append(internal, h)
+		} else {
+			handles = append(handles, h)
+		}
+	}
+	for _, group := range []struct {
+		format  string
+		handles []Handle
+	}{
+		{"%d open handles\n", handles},
+		{"%d internal handles\n", internal},
+	} {
+		if _, err := fmt.Fprintf(w, group.format, len(group.handles)); err != nil {
+			return err
+		}
+		for _, h := range group.handles {
+			if _, err := fmt.Fprintln(w, h); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (fs *trackedFileSystem) Close() error {
+	trackers.Lock()
+	defer trackers.Unlock()
+
+	for i, t := range trackers.list {
+		if t == fs {
+			// Copy the list, TrackHandle keeps using the old one.
+			list := make([]*trackedFileSystem, 0, len(trackers.list)-1)
+			trackers.list = append(append(list, trackers.list[:i]...), trackers.list[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (fs *trackedFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *trackedFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	f, err := OpenContext(ctx, fs.fs, name)
+	if err != nil {
+		return nil, err
+	}
+	id := fs.add(newHandle(fs.fs.String(), name))
+	return &trackedFile{ReadSeekCloser: f, fs: fs, id: id}, nil
+}
+
+func (fs *trackedFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return fs.fs.Lstat(name)
+}
+
+func (fs *trackedFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.fs.Stat(name)
+}
+
+func (fs *trackedFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	return StatContext(ctx, fs.fs, name)
+}
+
+func (fs *trackedFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.fs.Readdir(name)
+}
+
+func (fs *trackedFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	return ReaddirContext(ctx, fs.fs, name)
+}
+
+func (fs *trackedFileSystem) Readlink(name string) (string, error) {
+	return Readlink(fs.fs, name)
+}
+
+func (fs *trackedFileSystem) String() string {
+	return fs.fs.String()
+}
+
+// trackedFile is a file opened by a trackedFileSystem.
+type trackedFile struct {
+	ReadSeekCloser
+	fs *trackedFileSystem
+	id int
+}
+
+func (f *trackedFile) Close() error {
+	f.fs.remove(f.id)
+	return f.ReadSeekCloser.Close()
+}
+
+var (
+	_ TrackedFileSystem  = (*trackedFileSystem)(nil)
+	_ ReadlinkFileSystem = (*trackedFileSystem)(nil)
+)
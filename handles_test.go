@@ -0,0 +1,89 @@
+package vfs_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+	"textmodes.com/vfs/zipfs"
+)
+
+func TestTrackHandles(t *testing.T) {
+	fs := vfs.TrackHandles(mapfs.New(map[string]string{"a": "a", "b": "b"}))
+	defer fs.Close()
+
+	a, err := fs.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := fs.Open("/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	handles := fs.OpenHandles()
+	if len(handles) != 1 {
+		t.Fatalf("expected 1 open handle, got %d", len(handles))
+	}
+	if h := handles[0]; h.Path != "/a" || h.FS != "mapfs" || !strings.Contains(h.Stack, "TestTrackHandles") {
+		t.Errorf("expected a handle of /a opened by TestTrackHandles, got %v", h)
+	}
+
+	var buf bytes.Buffer
+	if err = fs.Report(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "1 open handles\n/a (mapfs)") {
+		t.Errorf("unexpected report %q", buf.String())
+	}
+
+	a.Close()
+	if handles := fs.OpenHandles(); len(handles) != 0 {
+		t.Errorf("expected no open handles, got %v", handles)
+	}
+}
+
+func TestTrackHandlesInternal(t *testing.T) {
+	tracker := vfs.TrackHandles(mapfs.New(nil))
+
+	fs, err := zipfs.Open("testdata/zip/unix.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handles := tracker.OpenHandles(); len(handles) != 0 {
+		t.Errorf("expected the archive to be closed after reading it, got %v", handles)
+	}
+
+	f, err := fs.Open("/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handles := tracker.OpenHandles()
+	if len(handles) != 1 || handles[0].Path != "testdata/zip/unix.zip" || handles[0].FS != "" {
+		t.Errorf("expected an internal handle of the archive, got %v", handles)
+	}
+	var buf bytes.Buffer
+	if err = tracker.Report(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "0 open handles\n1 internal handles\ntestdata/zip/unix.zip (internal)") {
+		t.Errorf("expected the internal handle to be reported separately, got %q", buf.String())
+	}
+	f.Close()
+	if handles := tracker.OpenHandles(); len(handles) != 0 {
+		t.Errorf("expected no open handles, got %v", handles)
+	}
+
+	// Closed trackers don't record internal handles.
+	tracker.Close()
+	if f, err = fs.Open("/hello"); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if handles := tracker.OpenHandles(); len(handles) != 0 {
+		t.Errorf("expected no handles after Close, got %v", handles)
+	}
+}
@@ -0,0 +1,13 @@
+package vfs
+
+import "net/http"
+
+// HTTPFileSystem returns an http.FileSystem serving fs, suitable for use with
+// http.FileServer.
+//
+// Range and conditional requests are served using the Seek method of the
+// opened files and the ModTime reported by Stat; directories are listed using
+// Readdir.
+func HTTPFileSystem(fs FileSystem) http.FileSystem {
+	return http.FS(ToFS(fs))
+}
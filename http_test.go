@@ -0,0 +1,65 @@
+package vfs_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/zipfs"
+)
+
+func TestHTTPFileSystem(t *testing.T) {
+	archive, err := zipfs.Open("testdata/zip/test.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := vfs.NewScope()
+	fs.Bind("/test.zip", "/", archive, vfs.BindReplace)
+
+	server := httptest.NewServer(http.FileServer(vfs.HTTPFileSystem(fs)))
+	defer server.Close()
+
+	tests := []struct {
+		path, rangeHeader string
+		status            int
+		want              string
+	}{
+		{"/test.zip/test.txt", "", http.StatusOK, "This is a test text file.\n"},
+		{"/test.zip/test.txt", "bytes=5-6", http.StatusPartialContent, "is"},
+		{"/test.zip/test.txt", "bytes=-5", http.StatusPartialContent, "ile.\n"},
+		{"/test.zip/", "", http.StatusOK, `<a href="test.txt">test.txt</a>`},
+		{"/test.zip/missing", "", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", server.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.rangeHeader != "" {
+			req.Header.Set("Range", test.rangeHeader)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != test.status {
+			t.Errorf("GET %s (Range %q): expected status %d, got %d", test.path, test.rangeHeader, test.status, res.StatusCode)
+			continue
+		}
+		if test.status == http.StatusOK && strings.HasSuffix(test.path, "/") {
+			if !strings.Contains(string(body), test.want) {
+				t.Errorf("GET %s: expected listing to contain %q, got %q", test.path, test.want, body)
+			}
+		} else if test.want != "" && string(body) != test.want {
+			t.Errorf("GET %s (Range %q): expected %q, got %q", test.path, test.rangeHeader, test.want, body)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package vfs
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// OverlayFileSystem is a FileSystem that mounts other file systems on demand,
+// such as the archives mounted by autofs.
+type OverlayFileSystem interface {
+	FileSystem
+
+	// WrapOverlays calls wrap for every file system mounted so far and
+	// from now on, with the path it is mounted at, and uses the result in
+	// its place.
+	WrapOverlays(wrap func(name string, fs FileSystem) FileSystem)
+}
+
+// instrumentedOps are the operations recorded by Instrument.
+var instrumentedOps = []string{"open", "stat", "lstat", "readdir", "readlink"}
+
+// latencyBuckets are the upper bounds of the latency histograms.
+var latencyBuckets = []struct {
+	max  time.Duration
+	name string
+}{
+	{100 * time.Microsecond, "100us"},
+	{time.Millisecond, "1ms"},
+	{10 * time.Millisecond, "10ms"},
+	{100 * time.Millisecond, "100ms"},
+	{time.Second, "1s"},
+	{10 * time.Second, "10s"},
+}
+
+// Instrument returns a FileSystem that records metrics for the operations on
+// fs, and publishes them with expvar under name. The published map contains:
+//
+//	calls       number of calls by operation
+//	errors      number of errors by kind, such as "not_exist" or "corrupt"
+//	latency     cumulative latency histograms by operation, in buckets
+//	            "le_1ms" etc. counting the calls that took at most that
+//	            long, and "inf" counting all calls
+//	bytes_read  number of bytes read from opened files
+//	open_files  number of files currently open
+//	mounts      the same metrics for each mount of a Scope, by mount point,
+//	            or for each overlay of an OverlayFileSystem, by path
+//
+// If fs is a Scope or SyncScope, its mounts are instrumented as they are
+// looked up, so binds made to fs later are instrumented too. If fs is an
+// OverlayFileSystem, its overlays are instrumented in place: calls made
+// through fs itself are counted in the mounts metrics too, and instrumenting
+// fs again under the same name doesn't count them twice.
+//
+// Instrumenting a second FileSystem with the same name adds to the existing
+// metrics. Like expvar.Publish, Instrument panics if name is already in use
+// by a variable that isn't an *expvar.Map.
+func Instrument(fs FileSystem, name string) FileSystem {
+	var m *expvar.Map
+	if v := expvar.Get(name); v != nil {
+		m = v.(*expvar.Map)
+	} else {
+		m = new(expvar.Map).Init()
+		expvar.Publish(name, m)
+	}
+
+	total := newMetrics(m)
+	mounts := new(expvar.Map).Init()
+	if v, ok := m.Get("mounts").(*expvar.Map); ok {
+		mounts = v
+	} else {
+		m.Set("mounts", mounts)
+	}
+	mount := func(name string) metrics {
+		v, ok := mounts.Get(name).(*expvar.Map)
+		if !ok {
+			v = new(expvar.Map).Init()
+			mounts.Set(name, v)
+		}
+		return newMetrics(v)
+	}
+
+	switch fs := fs.(type) {
+	case Scope, *SyncScope:
+		scope := instrumentedScope{fs: fs, mount: mount, last: new(atomic.Value)}
+		return instrumentedFileSystem{scope, total}
+	case OverlayFileSystem:
+		fs.WrapOverlays(func(name string, fs FileSystem) FileSystem {
+			m := mount(name)
+			if isInstrumented(fs, m) {
+				return fs
+			}
+			return instrumentedFileSystem{fs, m}
+		})
+	}
+	return instrumentedFileSystem{fs, total}
+}
+
+// isInstrumented reports whether fs already records its metrics in m.
+func isInstrumented(fs FileSystem, m metrics) bool {
+	for {
+		i, ok := fs.(instrumentedFileSystem)
+		if !ok {
+			return false
+		}
+		if i.metrics.Map == m.Map {
+			return true
+		}
+		fs = i.fs
+	}
+}
+
+// metrics are the metrics of an instrumented file system.
+type metrics struct {
+	*expvar.Map
+	calls   *expvar.Map
+	errors  *expvar.Map
+	latency *expvar.Map
+}
+
+func newMetrics(m *expvar.Map) metrics {
+	sub := func(name string) *expvar.Map {
+		if v, ok := m.Get(name).(*expvar.Map); ok {
+			return v
+		}
+		v := new(expvar.Map).Init()
+		m.Set(name, v)
+		return v
+	}
+	latency := sub("latency")
+	for _, op := range instrumentedOps {
+		if latency.Get(op) == nil {
+			latency.Set(op, new(expvar.Map).Init())
+		}
+	}
+	return metrics{
+		Map:     m,
+		calls:   sub("calls"),
+		errors:  sub("errors"),
+		latency: latency,
+	}
+}
+
+// observe records a call of op that started at start and returned err.
+func (m metrics) observe(op string, start time.Time, err error) {
+	d := time.Since(start)
+	m.calls.Add(op, 1)
+	if err != nil {
+		m.errors.Add(errorKind(err), 1)
+	}
+
+	h := m.latency.Get(op).(*expvar.Map)
+	for _, b := range latencyBuckets {
+		if d <= b.max {
+			h.Add("le_"+b.name, 1)
+		}
+	}
+	h.Add("inf", 1)
+}
+
+// errorKind returns the kind of err used for the errors metric.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	case errors.Is(err, os.ErrNotExist):
+		return "not_exist"
+	case errors.Is(err, os.ErrPermission):
+		return "permission"
+	case errors.Is(err, ErrIsDir):
+		return "is_dir"
+	case errors.Is(err, ErrNotDir):
+		return "not_dir"
+	case errors.Is(err, ErrCorrupt):
+		return "corrupt"
+	case errors.Is(err, ErrEncrypted), errors.Is(err, ErrPasswordRequired):
+		return "encrypted"
+	case errors.Is(err, ErrNotSupported):
+		return "not_supported"
+	case errors.Is(err, ErrSymlinkLoop):
+		return "symlink_loop"
+	case errors.Is(err, ErrTooLarge):
+		return "too_large"
+	case errors.Is(err, ErrAmbiguous):
+		return "ambiguous"
+	default:
+		return "other"
+	}
+}
+
+// instrumentedScope is a Scope or SyncScope with its mounts instrumented,
+// using the mount table at the time of each call.
+type instrumentedScope struct {
+	fs    FileSystem // Scope or *SyncScope
+	mount func(root string) metrics
+	last  *atomic.Value // instrumentedSnapshot
+}
+
+// instrumentedSnapshot is a mount table and its instrumented copy.
+type instrumentedSnapshot struct {
+	snapshot, scope Scope
+}
+
+// scope returns a copy of the current mount table, with the mounts
+// instrumented. The copy of the last mount table is reused until it changes.
+// The mount tables of a SyncScope are replaced rather than modified, so they
+// are compared by identity; a Scope is modified in place, so a copy of it is
+// kept and compared mount by mount.
+func (s instrumentedScope) scope() Scope {
+	var current Scope
+	switch fs := s.fs.(type) {
+	case Scope:
+		current = fs
+		if last, ok := s.last.Load().(instrumentedSnapshot); ok && sameMounts(last.snapshot, current) {
+			return last.scope
+		}
+	case *SyncScope:
+		current = fs.Snapshot()
+		if last, ok := s.last.Load().(instrumentedSnapshot); ok && sameFileSystem(last.snapshot, current) {
+			return last.scope
+		}
+	}
+
+	var (
+		_, copied = s.fs.(Scope)
+		snapshot  = current
+		scope     = make(Scope, len(current))
+	)
+	if copied {
+		snapshot = make(Scope, len(current))
+	}
+	for root, mounts := range current {
+		instrumented := make([]fileSystem, len(mounts))
+		if copied {
+			snapshot[root] = append([]fileSystem(nil), mounts...)
+		}
+		for i, m := range mounts {
+			m.fs = instrumentedFileSystem{m.fs, s.mount(root)}
+			instrumented[i] = m
+		}
+		scope[root] = instrumented
+	}
+	s.last.Store(instrumentedSnapshot{snapshot, scope})
+	return scope
+}
+
+// sameMounts reports whether the mount tables a and b are the same.
+func sameMounts(a, b Scope) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for root, mounts := range a {
+		other, ok := b[root]
+		if !ok || len(mounts) != len(other) {
+			return false
+		}
+		for i, m := range mounts {
+			o := other[i]
+			if m.root != o.root || m.base != o.base || m.opts != o.opts || m.lazy != o.lazy || !sameFileSystem(m.fs, o.fs) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s instrumentedScope) Open(name string) (ReadSeekCloser, error) {
+	return s.scope().Open(name)
+}
+
+func (s instrumentedScope) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	return s.scope().OpenContext(ctx, name)
+}
+
+func (s instrumentedScope) Lstat(name string) (os.FileInfo, error) {
+	return s.scope().Lstat(name)
+}
+
+func (s instrumentedScope) Stat(name string) (os.FileInfo, error) {
+	return s.scope().Stat(name)
+}
+
+func (s instrumentedScope) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	return s.scope().StatContext(ctx, name)
+}
+
+func (s instrumentedScope) Readdir(name string) ([]os.FileInfo, error) {
+	return s.scope().Readdir(name)
+}
+
+func (s instrumentedScope) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	return s.scope().ReaddirContext(ctx, name)
+}
+
+func (s instrumentedScope) Readlink(name string) (string, error) {
+	return s.scope().Readlink(name)
+}
+
+func (s instrumentedScope) String() string {
+	return s.fs.String()
+}
+
+type instrumentedFileSystem struct {
+	fs      FileSystem
+	metrics metrics
+}
+
+func (fs instrumentedFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs instrumentedFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	start := time.Now()
+	f, err := OpenContext(ctx, fs.fs, name)
+	fs.metrics.observe("open", start, err)
+	if err != nil {
+		return nil, err
+	}
+	fs.metrics.Add("open_files", 1)
+	return &instrumentedFile{ReadSeekCloser: f, metrics: fs.metrics}, nil
+}
+
+func (fs instrumentedFileSystem) Lstat(name string) (os.FileInfo, error) {
+	start := time.Now()
+	info, err := fs.fs.Lstat(name)
+	fs.metrics.observe("lstat", start, err)
+	return info, err
+}
+
+func (fs instrumentedFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.StatContext(context.Background(), name)
+}
+
+func (fs instrumentedFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	start := time.Now()
+	info, err := StatContext(ctx, fs.fs, name)
+	fs.metrics.observe("stat", start, err)
+	return info, err
+}
+
+func (fs instrumentedFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs instrumentedFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	start := time.Now()
+	infos, err := ReaddirContext(ctx, fs.fs, name)
+	fs.metrics.observe("readdir", start, err)
+	return infos, err
+}
+
+func (fs instrumentedFileSystem) Readlink(name string) (string, error) {
+	start := time.Now()
+	target, err := Readlink(fs.fs, name)
+	fs.metrics.observe("readlink", start, err)
+	return target, err
+}
+
+func (fs instrumentedFileSystem) String() string {
+	return fs.fs.String()
+}
+
+// instrumentedFile counts the bytes read from a file opened by an
+// instrumentedFileSystem.
+type instrumentedFile struct {
+	ReadSeekCloser
+	metrics metrics
+	closed  bool
+}
+
+func (f *instrumentedFile) Read(p []byte) (int, error) {
+	n, err := f.ReadSeekCloser.Read(p)
+	f.metrics.Add("bytes_read", int64(n))
+	return n, err
+}
+
+func (f *instrumentedFile) Close() error {
+	if !f.closed {
+		f.closed = true
+		f.metrics.Add("open_files", -1)
+	}
+	return f.ReadSeekCloser.Close()
+}
+
+var (
+	_ ContextFileSystem  = instrumentedFileSystem{}
+	_ ContextFileSystem  = instrumentedScope{}
+	_ ReadlinkFileSystem = instrumentedFileSystem{}
+	_ ReadlinkFileSystem = instrumentedScope{}
+)
@@ -0,0 +1,156 @@
+package vfs_test
+
+import (
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/autofs"
+	"textmodes.com/vfs/mapfs"
+)
+
+var metricNames int32
+
+// metricName returns a name for the metrics of test t that isn't used by
+// previous runs of t, as with -count.
+func metricName(t *testing.T) string {
+	return fmt.Sprintf("vfs_%s_%d", t.Name(), atomic.AddInt32(&metricNames, 1))
+}
+
+// metric returns the value of the expvar at path, or 0.
+func metric(path ...string) int64 {
+	v := expvar.Get(path[0])
+	for _, key := range path[1:] {
+		m, ok := v.(*expvar.Map)
+		if !ok {
+			return 0
+		}
+		v = m.Get(key)
+	}
+	if i, ok := v.(*expvar.Int); ok {
+		return i.Value()
+	}
+	return 0
+}
+
+func TestInstrument(t *testing.T) {
+	scope := vfs.NewScope()
+	scope.Bind("/", "/", mapfs.New(map[string]string{"a": "abc"}), vfs.BindReplace)
+	scope.Bind("/m", "/", mapfs.New(map[string]string{"b": "b"}), vfs.BindReplace)
+	name := metricName(t)
+	fs := vfs.Instrument(scope, name)
+
+	f, err := fs.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := metric(name, "open_files"), int64(1); got != want {
+		t.Errorf("expected %d open files, got %d", want, got)
+	}
+	if _, err = ioutil.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	fs.Stat("/m/missing")
+
+	tests := []struct {
+		path []string
+		want int64
+	}{
+		{[]string{"calls", "open"}, 1},
+		{[]string{"calls", "stat"}, 1},
+		{[]string{"errors", "not_exist"}, 1},
+		{[]string{"bytes_read"}, 3},
+		{[]string{"open_files"}, 0},
+		{[]string{"mounts", "/", "calls", "open"}, 1},
+		{[]string{"mounts", "/m", "calls", "stat"}, 1},
+		{[]string{"mounts", "/m", "calls", "open"}, 0},
+	}
+	for _, test := range tests {
+		got := metric(append([]string{name}, test.path...)...)
+		if got != test.want {
+			t.Errorf("%v: expected %d, got %d", test.path, test.want, got)
+		}
+	}
+
+	// The histogram buckets are cumulative.
+	var prev int64
+	for _, bucket := range []string{"le_100us", "le_1ms", "le_10ms", "le_100ms", "le_1s", "le_10s", "inf"} {
+		n := metric(name, "latency", "open", bucket)
+		if n < prev {
+			t.Errorf("latency bucket %s: expected at least %d, got %d", bucket, prev, n)
+		}
+		prev = n
+	}
+	if prev != 1 {
+		t.Errorf("expected 1 open in the latency histogram, got %d", prev)
+	}
+}
+
+func TestInstrumentLaterBinds(t *testing.T) {
+	var (
+		scope      = vfs.NewScope()
+		sync       = vfs.NewSyncScope()
+		scopeName  = metricName(t)
+		syncName   = metricName(t)
+		m          = mapfs.New(map[string]string{"a": "a"})
+		replaced   = mapfs.New(map[string]string{"b": "b"})
+		instrument = map[string]vfs.FileSystem{
+			scopeName: vfs.Instrument(scope, scopeName),
+			syncName:  vfs.Instrument(sync, syncName),
+		}
+	)
+	for _, fs := range instrument {
+		fs.Stat("/")
+	}
+	scope.Bind("/m", "/", m, vfs.BindReplace)
+	sync.Bind("/m", "/", m, vfs.BindReplace)
+	for name, fs := range instrument {
+		if _, err := fs.Stat("/m/a"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := metric(name, "mounts", "/m", "calls", "stat"); got != 1 {
+			t.Errorf("%s: expected 1 stat of the mount bound later, got %d", name, got)
+		}
+	}
+
+	// Mounts replaced in place are instrumented too.
+	scope.Rebind("/m", m, replaced)
+	sync.Rebind("/m", m, replaced)
+	for name, fs := range instrument {
+		if _, err := fs.Stat("/m/b"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := metric(name, "mounts", "/m", "calls", "stat"); got != 2 {
+			t.Errorf("%s: expected 2 stats of the mount, got %d", name, got)
+		}
+	}
+}
+
+func TestInstrumentOverlay(t *testing.T) {
+	afs, err := autofs.New("testdata/zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := metricName(t)
+	fs := vfs.Instrument(afs, name)
+
+	if _, err = fs.Readdir("/unix.zip/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if got := metric(name, "mounts", "/unix.zip", "calls", "readdir"); got != 1 {
+		t.Errorf("expected 1 readdir of the overlay, got %d", got)
+	}
+
+	// Instrumenting again under the same name doesn't count calls twice.
+	fs = vfs.Instrument(afs, name)
+	if _, err = fs.Readdir("/unix.zip/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if got := metric(name, "mounts", "/unix.zip", "calls", "readdir"); got != 2 {
+		t.Errorf("expected 2 readdirs of the overlay, got %d", got)
+	}
+}
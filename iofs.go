@@ -0,0 +1,305 @@
+package vfs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// ToFS returns an io/fs.FS view of fsys. The returned value also implements
+// fs.ReadDirFS, fs.StatFS and fs.ReadFileFS.
+func ToFS(fsys FileSystem) fs.FS {
+	if from, ok := fsys.(fromFS); ok {
+		return from.fsys
+	}
+	return toFS{fsys}
+}
+
+// FromFS returns a FileSystem backed by an io/fs.FS.
+//
+// Files that do not implement io.Seeker are emulated by reopening and
+// skipping to the requested offset.
+func FromFS(fsys fs.FS) FileSystem {
+	if to, ok := fsys.(toFS); ok {
+		return to.fsys
+	}
+	return fromFS{fsys}
+}
+
+type toFS struct {
+	fsys FileSystem
+}
+
+// resolve translates an io/fs name to a rooted FileSystem path.
+func (fsys toFS) resolve(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return "/", nil
+	}
+	return "/" + name, nil
+}
+
+func (fsys toFS) Open(name string) (fs.File, error) {
+	full, err := fsys.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fsys.fsys.Stat(full)
+	if err != nil {
+		return nil, fsPathError("open", name, err)
+	}
+	info = fsFileInfo{info, path.Base(name)}
+	if info.IsDir() {
+		return &fsDir{fsys: fsys.fsys, name: name, path: full, info: info}, nil
+	}
+	f, err := fsys.fsys.Open(full)
+	if err != nil {
+		return nil, fsPathError("open", name, err)
+	}
+	return fsFile{f, info}, nil
+}
+
+func (fsys toFS) Stat(name string) (fs.FileInfo, error) {
+	full, err := fsys.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fsys.fsys.Stat(full)
+	if err != nil {
+		return nil, fsPathError("stat", name, err)
+	}
+	return fsFileInfo{info, path.Base(name)}, nil
+}
+
+func (fsys toFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	full, err := fsys.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return readDir(fsys.fsys, name, full)
+}
+
+func (fsys toFS) ReadFile(name string) ([]byte, error) {
+	full, err := fsys.resolve("read", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fsys.fsys.Open(full)
+	if err != nil {
+		return nil, fsPathError("read", name, err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fsPathError("read", name, err)
+	}
+	return b, nil
+}
+
+// readDir lists the directory at full as fs.DirEntry values.
+func readDir(fsys FileSystem, name, full string) ([]fs.DirEntry, error) {
+	infos, err := fsys.Readdir(full)
+	if err != nil {
+		return nil, fsPathError("readdir", name, err)
+	}
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(fsFileInfo{info, path.Base(info.Name())})
+	}
+	return entries, nil
+}
+
+// fsPathError wraps err in an *fs.PathError for the io/fs name.
+func fsPathError(op, name string, err error) error {
+	if pe, ok := err.(*fs.PathError); ok {
+		err = pe.Err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// fsFileInfo overrides the name of an os.FileInfo, since not all backends
+// agree on the name of their root directory.
+type fsFileInfo struct {
+	os.FileInfo
+	name string
+}
+
+func (fi fsFileInfo) Name() string { return fi.name }
+
+// fsFile is an fs.File for a regular file.
+type fsFile struct {
+	ReadSeekCloser
+	info fs.FileInfo
+}
+
+func (f fsFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// fsDir is an fs.ReadDirFile for a directory.
+type fsDir struct {
+	fsys    FileSystem
+	name    string
+	path    string
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: ErrIsDir}
+}
+
+func (d *fsDir) Close() error { return nil }
+
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		entries, err := readDir(d.fsys, d.name, d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+	}
+
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
+
+type fromFS struct {
+	fsys fs.FS
+}
+
+// resolve translates a rooted FileSystem path to an io/fs name.
+func (fsys fromFS) resolve(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (fsys fromFS) Open(name string) (ReadSeekCloser, error) {
+	Tracef(fsys, "Open(%q)", name)
+	name = fsys.resolve(name)
+	f, err := fsys.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrIsDir}
+	}
+	if s, ok := f.(io.Seeker); ok {
+		return seekFile{f, s}, nil
+	}
+	return &reopenFile{File: f, fsys: fsys.fsys, name: name, size: info.Size()}, nil
+}
+
+func (fsys fromFS) Lstat(name string) (os.FileInfo, error) {
+	Tracef(fsys, "Lstat(%q)", name)
+	return fs.Stat(fsys.fsys, fsys.resolve(name))
+}
+
+func (fsys fromFS) Stat(name string) (os.FileInfo, error) {
+	Tracef(fsys, "Stat(%q)", name)
+	return fs.Stat(fsys.fsys, fsys.resolve(name))
+}
+
+func (fsys fromFS) Readdir(name string) ([]os.FileInfo, error) {
+	Tracef(fsys, "Readdir(%q)", name)
+	entries, err := fs.ReadDir(fsys.fsys, fsys.resolve(name))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, len(entries))
+	for i, entry := range entries {
+		if infos[i], err = entry.Info(); err != nil {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
+
+func (fsys fromFS) String() string {
+	return fmt.Sprintf("iofs(%T)", fsys.fsys)
+}
+
+// seekFile is an fs.File that implements io.Seeker.
+type seekFile struct {
+	fs.File
+	io.Seeker
+}
+
+// reopenFile emulates io.Seeker for an fs.File by reopening the file and
+// skipping ahead to the requested offset.
+type reopenFile struct {
+	fs.File
+	fsys   fs.FS
+	name   string
+	size   int64
+	offset int64
+}
+
+func (f *reopenFile) Read(p []byte) (n int, err error) {
+	n, err = f.File.Read(p)
+	f.offset += int64(n)
+	return
+}
+
+func (f *reopenFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrInvalid}
+	}
+
+	if offset < f.offset {
+		r, err := f.fsys.Open(f.name)
+		if err != nil {
+			return 0, err
+		}
+		f.File.Close()
+		f.File, f.offset = r, 0
+	}
+	if _, err := io.CopyN(ioutil.Discard, f, offset-f.offset); err != nil && err != io.EOF {
+		return 0, err
+	}
+	return f.offset, nil
+}
+
+var (
+	_ fs.ReadDirFS   = toFS{}
+	_ fs.ReadFileFS  = toFS{}
+	_ fs.StatFS      = toFS{}
+	_ FileSystem     = fromFS{}
+	_ fs.ReadDirFile = (*fsDir)(nil)
+)
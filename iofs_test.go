@@ -0,0 +1,58 @@
+package vfs_test
+
+import (
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+)
+
+func TestToFS(t *testing.T) {
+	fs := vfs.NewScope()
+	fs.Bind("/", "/", mapfs.New(map[string]string{
+		"foo/bar/three.txt": "333",
+		"foo/bar.txt":       "22",
+		"top.txt":           "top.txt file",
+	}), vfs.BindReplace)
+
+	if err := fstest.TestFS(vfs.ToFS(fs), "foo/bar/three.txt", "foo/bar.txt", "top.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFromFS(t *testing.T) {
+	fs := vfs.FromFS(fstest.MapFS{
+		"foo/bar.txt": &fstest.MapFile{Data: []byte("bar")},
+		"top.txt":     &fstest.MapFile{Data: []byte("top")},
+	})
+
+	infos, err := fs.Readdir("/")
+	if err != nil {
+		t.Fatalf("Readdir: %v", err)
+	}
+	if len(infos) != 2 || infos[0].Name() != "foo" || infos[1].Name() != "top.txt" {
+		t.Fatalf("unexpected Readdir result: %v", infos)
+	}
+
+	f, err := fs.Open("/foo/bar.txt")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	if _, err = f.Seek(1, 0); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "ar" {
+		t.Errorf("expected %q, got %q", "ar", b)
+	}
+
+	if _, err = fs.Open("/foo"); err == nil {
+		t.Error("expected Open of a directory to fail")
+	}
+}
@@ -0,0 +1,184 @@
+package vfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Retry backoff for the constructors of BindFunc. After a constructor fails,
+// its error is returned until the backoff expires; the backoff starts at
+// BindFuncMinRetry and doubles with every failure, up to BindFuncMaxRetry.
+var (
+	BindFuncMinRetry = time.Second
+	BindFuncMaxRetry = time.Minute
+)
+
+// lazyFileSystem is a FileSystem bound with BindFunc or BindFuncContext. The
+// file system is created on the first call that reaches it.
+type lazyFileSystem struct {
+	root string
+	open func(ctx context.Context) (FileSystem, error)
+
+	mu       sync.Mutex
+	fs       FileSystem
+	call     *lazyCall // in flight, or nil
+	err      error     // of the last failed call
+	failures int
+	retry    time.Time
+}
+
+// lazyCall is a call of the constructor, shared by all callers waiting for
+// it. The context of the constructor is canceled when the last caller stops
+// waiting.
+type lazyCall struct {
+	done    chan struct{}
+	fs      FileSystem
+	err     error
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// get returns the file system, calling the constructor if it hasn't been
+// created yet. Concurrent callers share one call of the constructor; callers
+// stop waiting for it when ctx is done.
+func (fs *lazyFileSystem) get(ctx context.Context) (FileSystem, error) {
+	fs.mu.Lock()
+	if fs.fs != nil {
+		defer fs.mu.Unlock()
+		return fs.fs, nil
+	}
+	if fs.err != nil && time.Now().Before(fs.retry) {
+		defer fs.mu.Unlock()
+		return nil, fs.err
+	}
+	call := fs.call
+	if call == nil || call.waiters == 0 {
+		// Not calling, or the call is canceled.
+		callCtx, cancel := context.WithCancel(context.Background())
+		call = &lazyCall{done: make(chan struct{}), cancel: cancel}
+		fs.call = call
+		go fs.do(callCtx, call)
+	}
+	call.waiters++
+	fs.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.fs, call.err
+	case <-ctx.Done():
+		fs.mu.Lock()
+		if call.waiters--; call.waiters == 0 {
+			call.cancel()
+		}
+		fs.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// do calls the constructor for call and records the result.
+func (fs *lazyFileSystem) do(ctx context.Context, call *lazyCall) {
+	defer call.cancel()
+
+	Tracef(fs, "BindFunc: mounting %q", fs.root)
+	call.fs, call.err = fs.open(ctx)
+	if call.err == nil && call.fs == nil {
+		call.err = &os.PathError{Op: "bind", Path: fs.root, Err: os.ErrNotExist}
+	}
+
+	fs.mu.Lock()
+	if fs.call == call {
+		fs.call = nil
+	}
+	var backoff time.Duration
+	switch {
+	case call.err == nil:
+		fs.fs, fs.err = call.fs, nil
+	case ctx.Err() != nil:
+		// Canceled calls are retried by the next caller.
+	default:
+		backoff = BindFuncMinRetry << uint(fs.failures)
+		if backoff > BindFuncMaxRetry || backoff <= 0 {
+			backoff = BindFuncMaxRetry
+		}
+		fs.failures++
+		fs.err, fs.retry = call.err, time.Now().Add(backoff)
+	}
+	close(call.done)
+	fs.mu.Unlock()
+
+	if backoff > 0 {
+		Tracef(fs, "BindFunc: mounting %q: %v, retrying in %s", fs.root, call.err, backoff)
+	}
+}
+
+func (fs *lazyFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *lazyFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	lfs, err := fs.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return OpenContext(ctx, lfs, name)
+}
+
+func (fs *lazyFileSystem) Lstat(name string) (os.FileInfo, error) {
+	lfs, err := fs.get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return lfs.Lstat(name)
+}
+
+func (fs *lazyFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.StatContext(context.Background(), name)
+}
+
+func (fs *lazyFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	lfs, err := fs.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return StatContext(ctx, lfs, name)
+}
+
+func (fs *lazyFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs *lazyFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	lfs, err := fs.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ReaddirContext(ctx, lfs, name)
+}
+
+func (fs *lazyFileSystem) Readlink(name string) (string, error) {
+	lfs, err := fs.get(context.Background())
+	if err != nil {
+		return "", err
+	}
+	return Readlink(lfs, name)
+}
+
+// String returns the description of the file system once it is created, and
+// "lazy(root)" before.
+func (fs *lazyFileSystem) String() string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.fs != nil {
+		return fs.fs.String()
+	}
+	return fmt.Sprintf("lazy(%s)", fs.root)
+}
+
+var (
+	_ ContextFileSystem  = (*lazyFileSystem)(nil)
+	_ ReadlinkFileSystem = (*lazyFileSystem)(nil)
+)
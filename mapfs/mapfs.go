@@ -32,7 +32,10 @@ func filename(p string) string {
 func (fs mapFS) Open(p string) (vfs.ReadSeekCloser, error) {
 	b, ok := fs[filename(p)]
 	if !ok {
-		return nil, os.ErrNotExist
+		if ents, _ := fs.Readdir(p); len(ents) > 0 {
+			return nil, &os.PathError{Op: "open", Path: p, Err: vfs.ErrIsDir}
+		}
+		return nil, &os.PathError{Op: "open", Path: p, Err: os.ErrNotExist}
 	}
 	return nopCloser{strings.NewReader(b)}, nil
 }
@@ -54,7 +57,7 @@ func (fs mapFS) Lstat(p string) (os.FileInfo, error) {
 	if len(ents) > 0 {
 		return dirInfo(p), nil
 	}
-	return nil, os.ErrNotExist
+	return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
 }
 
 func (fs mapFS) Stat(p string) (os.FileInfo, error) {
@@ -109,7 +112,10 @@ func (fs mapFS) Readdir(p string) ([]os.FileInfo, error) {
 		}
 	}
 	if len(ents) == 0 {
-		return nil, os.ErrNotExist
+		if _, ok := fs[filename(p)]; ok {
+			return nil, &os.PathError{Op: "readdir", Path: p, Err: vfs.ErrNotDir}
+		}
+		return nil, &os.PathError{Op: "readdir", Path: p, Err: os.ErrNotExist}
 	}
 
 	sort.Strings(ents)
@@ -0,0 +1,62 @@
+package vfs
+
+import (
+	"os"
+	"time"
+)
+
+// Metadata is extended information about a file, beyond what os.FileInfo
+// provides. Fields a file system doesn't record are left at their zero value,
+// except for Uid and Gid which are -1 when unknown.
+type Metadata struct {
+	// Uid and Gid are the numeric owner and group IDs.
+	Uid, Gid int
+
+	// Uname and Gname are the owner and group names.
+	Uname, Gname string
+
+	// AccessTime, ChangeTime and BirthTime are the access, status change
+	// and creation times.
+	AccessTime, ChangeTime, BirthTime time.Time
+
+	// CompressedSize is the size of the file as stored in an archive.
+	CompressedSize int64
+
+	// Method is the compression method of an archive entry, such as
+	// "store" or "deflate".
+	Method string
+
+	// Checksum is the checksum of the contents stored in an archive, and
+	// ChecksumType the algorithm used, such as "crc32".
+	Checksum     []byte
+	ChecksumType string
+
+	// Comment is the comment stored with an archive entry.
+	Comment string
+
+	// Archive is the name of the archive containing the file.
+	Archive string
+}
+
+// MetadataInfo is implemented by the os.FileInfo of file systems that record
+// extended metadata. See MetadataOf.
+type MetadataInfo interface {
+	os.FileInfo
+
+	// Metadata returns the extended metadata of the file.
+	Metadata() Metadata
+}
+
+// MetadataOf returns the extended metadata of info, as returned by any of the
+// FileSystem implementations. For files on disk the metadata is read from
+// the info's Sys value, where the platform supports it.
+func MetadataOf(info os.FileInfo) Metadata {
+	if info, ok := info.(MetadataInfo); ok {
+		return info.Metadata()
+	}
+	md := Metadata{Uid: -1, Gid: -1}
+	if info != nil {
+		sysMetadata(info.Sys(), &md)
+	}
+	return md
+}
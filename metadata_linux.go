@@ -0,0 +1,17 @@
+package vfs
+
+import (
+	"syscall"
+	"time"
+)
+
+// sysMetadata fills md from the stat_t returned by os.Stat.
+func sysMetadata(sys interface{}, md *Metadata) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	md.Uid, md.Gid = int(st.Uid), int(st.Gid)
+	md.AccessTime = time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec))
+	md.ChangeTime = time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package vfs
+
+// sysMetadata fills md from the Sys value of an os.FileInfo; there is no
+// support for this platform yet.
+func sysMetadata(sys interface{}, md *Metadata) {}
@@ -0,0 +1,34 @@
+package vfs_test
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+)
+
+func TestMetadataOf(t *testing.T) {
+	info, err := mapfs.New(map[string]string{"a": "a"}).Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md := vfs.MetadataOf(info); md.Uid != -1 || md.Gid != -1 || md.Archive != "" {
+		t.Errorf("expected empty metadata, got %+v", md)
+	}
+
+	if runtime.GOOS != "linux" {
+		t.Skipf("no metadata for files on %s", runtime.GOOS)
+	}
+	if info, err = vfs.OS(".").Stat("metadata.go"); err != nil {
+		t.Fatal(err)
+	}
+	md := vfs.MetadataOf(info)
+	if md.Uid != os.Getuid() {
+		t.Errorf("expected uid %d, got %d", os.Getuid(), md.Uid)
+	}
+	if md.ChangeTime.IsZero() {
+		t.Error("expected a change time")
+	}
+}
@@ -6,9 +6,12 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
-// OS relative to root path.
+// OS relative to root path. The returned FileSystem also implements
+// WriteFileSystem.
 func OS(root string) FileSystem {
 	return osFileSystem{root}
 }
@@ -26,6 +29,20 @@ func (fs osFileSystem) resolve(name string) string {
 	return filepath.Join(fs.root, name)
 }
 
+// hostPath returns the path in fs of the absolute host path target, as used
+// by symbolic links, or false if target is outside of root.
+func (fs osFileSystem) hostPath(target string) (string, bool) {
+	root, err := filepath.Abs(fs.root)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path.Clean("/" + filepath.ToSlash(rel)), true
+}
+
 func (fs osFileSystem) Lstat(name string) (os.FileInfo, error) {
 	name = fs.resolve(name)
 	Tracef(fs, "Lstat(%q)", name)
@@ -54,17 +71,88 @@ func (fs osFileSystem) Open(name string) (ReadSeekCloser, error) {
 
 	if info.IsDir() {
 		f.Close()
-		return nil, fmt.Errorf("%s: is a directory", name)
+		return nil, &os.PathError{Op: "open", Path: name, Err: ErrIsDir}
 	}
 
 	return f, nil
 }
 
+func (fs osFileSystem) Readlink(name string) (string, error) {
+	name = fs.resolve(name)
+	Tracef(fs, "Readlink(%q)", name)
+	return os.Readlink(name)
+}
+
 func (fs osFileSystem) Readdir(name string) ([]os.FileInfo, error) {
 	Tracef(fs, "Readdir(%q)", fs.resolve(name))
 	return ioutil.ReadDir(fs.resolve(name)) // ioutil sorts the output
 }
 
+func (fs osFileSystem) Create(name string) (ReadWriteSeekCloser, error) {
+	return fs.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (fs osFileSystem) OpenFile(name string, flag int, perm os.FileMode) (ReadWriteSeekCloser, error) {
+	name = fs.resolve(name)
+	Tracef(fs, "OpenFile(%q, %#x, %s)", name, flag, perm)
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (fs osFileSystem) Mkdir(name string, perm os.FileMode) error {
+	name = fs.resolve(name)
+	Tracef(fs, "Mkdir(%q, %s)", name, perm)
+	return os.Mkdir(name, perm)
+}
+
+func (fs osFileSystem) MkdirAll(name string, perm os.FileMode) error {
+	name = fs.resolve(name)
+	Tracef(fs, "MkdirAll(%q, %s)", name, perm)
+	return os.MkdirAll(name, perm)
+}
+
+func (fs osFileSystem) Remove(name string) error {
+	name = fs.resolve(name)
+	Tracef(fs, "Remove(%q)", name)
+	return os.Remove(name)
+}
+
+func (fs osFileSystem) RemoveAll(name string) error {
+	name = fs.resolve(name)
+	if name == fs.resolve("/") {
+		// Never remove the root of the file system itself.
+		return &os.PathError{Op: "removeall", Path: name, Err: os.ErrPermission}
+	}
+	Tracef(fs, "RemoveAll(%q)", name)
+	return os.RemoveAll(name)
+}
+
+func (fs osFileSystem) Rename(oldname, newname string) error {
+	oldname, newname = fs.resolve(oldname), fs.resolve(newname)
+	Tracef(fs, "Rename(%q, %q)", oldname, newname)
+	return os.Rename(oldname, newname)
+}
+
+func (fs osFileSystem) Chmod(name string, mode os.FileMode) error {
+	name = fs.resolve(name)
+	Tracef(fs, "Chmod(%q, %s)", name, mode)
+	return os.Chmod(name, mode)
+}
+
+func (fs osFileSystem) Chtimes(name string, atime, mtime time.Time) error {
+	name = fs.resolve(name)
+	Tracef(fs, "Chtimes(%q, %s, %s)", name, atime, mtime)
+	return os.Chtimes(name, atime, mtime)
+}
+
 func (fs osFileSystem) String() string {
 	return fmt.Sprintf(`osFileSystem(%s)`, fs.root)
 }
+
+var (
+	_ ReadlinkFileSystem = osFileSystem{}
+	_ WriteFileSystem    = osFileSystem{}
+)
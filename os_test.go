@@ -0,0 +1,112 @@
+package vfs_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+)
+
+func TestScopeWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	scope := vfs.NewScope()
+	scope.Bind("/data", "/", mapfs.New(map[string]string{"readonly": "abc"}), vfs.BindReplace)
+	scope.Bind("/data", "/", vfs.OS(dir), vfs.BindAfter)
+
+	if err = scope.MkdirAll("/data/a/b", 0755); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+
+	f, err := scope.Create("/data/a/b/file")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err = io.WriteString(f, "hello"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if err = scope.Rename("/data/a/b/file", "/data/a/renamed"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	r, err := scope.Open("/data/a/renamed")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "hello" {
+		t.Errorf("expected contents %q, got %q", "hello", b)
+	}
+
+	if err = scope.Chmod("/data/a/renamed", 0600); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err = scope.Chtimes("/data/a/renamed", mtime, mtime); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	i, err := scope.Stat("/data/a/renamed")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if i.Mode().Perm() != 0600 {
+		t.Errorf("expected mode %s, got %s", os.FileMode(0600), i.Mode().Perm())
+	}
+	if !i.ModTime().Equal(mtime) {
+		t.Errorf("expected mtime %s, got %s", mtime, i.ModTime())
+	}
+
+	if err = scope.RemoveAll("/data/a"); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	if _, err = os.Stat(dir + "/a"); !os.IsNotExist(err) {
+		t.Errorf("expected %s/a to be removed, got %v", dir, err)
+	}
+
+	if err = scope.Mkdir("/elsewhere", 0755); err == nil {
+		t.Error("expected Mkdir outside of a writable mount to fail")
+	}
+
+	// A Chroot over a read-only file system can't be written to.
+	scope.Bind("/ro", "/", vfs.Chroot("/", mapfs.New(nil)), vfs.BindReplace)
+	scope.Bind("/ro", "/", vfs.OS(dir), vfs.BindAfter)
+	if err = scope.Mkdir("/ro/dir", 0755); err != nil {
+		t.Errorf("Mkdir below a read-only Scope: %v", err)
+	}
+	if _, err = os.Stat(dir + "/dir"); err != nil {
+		t.Errorf("expected %s/dir to be created, got %v", dir, err)
+	}
+}
+
+func TestOSRemoveAllRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, root := range []string{dir, dir + "/", dir + "/./"} {
+		fs := vfs.OS(root).(vfs.WriteFileSystem)
+		if err = fs.RemoveAll("/"); !os.IsPermission(err) {
+			t.Errorf("RemoveAll(\"/\") in %s: expected a permission error, got %v", root, err)
+		}
+		if _, err = os.Stat(dir); err != nil {
+			t.Fatalf("%s: %v", root, err)
+		}
+	}
+}
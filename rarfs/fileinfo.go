@@ -5,12 +5,15 @@ import (
 	"time"
 
 	rar "github.com/nwaples/rardecode"
+
+	"textmodes.com/vfs"
 )
 
 // fileInfo is the zip-file based implementation of FileInfo
 type fileInfo struct {
-	name string          // directory-local name
-	file *rar.FileHeader // nil for a directory
+	name    string          // directory-local name
+	file    *rar.FileHeader // nil for a directory
+	archive string          // name of the containing archive
 }
 
 func (fi fileInfo) Name() string {
@@ -48,3 +51,31 @@ func (fi fileInfo) IsDir() bool {
 func (fi fileInfo) Sys() interface{} {
 	return fi.file
 }
+
+func (fi fileInfo) Metadata() vfs.Metadata {
+	md := vfs.Metadata{
+		Uid:     -1,
+		Gid:     -1,
+		Archive: fi.archive,
+	}
+	if f := fi.file; f != nil {
+		md.AccessTime, md.BirthTime = f.AccessTime, f.CreationTime
+		md.CompressedSize = f.PackedSize
+	}
+	return md
+}
+
+// linkInfo is the FileInfo of a hard link or file copy, which reports the
+// size of the entry it links to.
+type linkInfo struct {
+	fileInfo
+	target *rar.FileHeader
+}
+
+func (fi linkInfo) Size() int64 {
+	return fi.target.UnPackedSize
+}
+
+func (fi linkInfo) HardLink() string {
+	return "/" + fi.target.Name
+}
@@ -4,12 +4,15 @@ Package rarfs implements a virtual file system from a RAR compressed archive.
 package rarfs
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"sort"
 	"strings"
+	"sync"
 
 	rar "github.com/nwaples/rardecode"
 
@@ -43,16 +46,56 @@ func (rsc emulatedFile) ReadAt(p []byte, off int64) (n int, err error) {
 	if _, err = rsc.Seek(off, io.SeekStart); err != nil {
 		return
 	}
-	return rsc.Read(p)
+	// Unlike Read, ReadAt must not return short reads without an error.
+	if n, err = io.ReadFull(rsc, p); err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return
+}
+
+// trackedFile is a fileLike registered with vfs.TrackHandle.
+type trackedFile struct {
+	fileLike
+	closed func()
+}
+
+func (f trackedFile) Close() error {
+	f.closed()
+	return f.fileLike.Close()
+}
+
+// contextFile is a fileLike that fails all reads once ctx is done.
+type contextFile struct {
+	fileLike
+	ctx context.Context
+}
+
+func (f contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.fileLike.Read(p)
+}
+
+func (f contextFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.fileLike.ReadAt(p, off)
 }
 
 // Open a name file on disk as FileSystem.
 func Open(name string, password ...string) (vfs.FileSystem, error) {
+	return OpenContext(context.Background(), name, password...)
+}
+
+// OpenContext is like Open, but stops reading the archive when ctx is done.
+func OpenContext(ctx context.Context, name string, password ...string) (vfs.FileSystem, error) {
 	var pwd string
 	if len(password) > 0 {
 		pwd = password[0]
 	}
-	return open(name, func() (fileLike, string, error) {
+	return open(ctx, name, func(context.Context) (fileLike, string, error) {
 		vfs.Tracef(nil, "os.Open(%q)", name)
 		f, err := os.Open(name)
 		return f, pwd, err
@@ -61,18 +104,24 @@ func Open(name string, password ...string) (vfs.FileSystem, error) {
 
 // OpenFile opens a file on a FileSystem as FileSystem.
 func OpenFile(fs vfs.FileSystem, name string, password ...string) (vfs.FileSystem, error) {
+	return OpenFileContext(context.Background(), fs, name, password...)
+}
+
+// OpenFileContext is like OpenFile, but stops reading the archive when ctx is
+// done.
+func OpenFileContext(ctx context.Context, fs vfs.FileSystem, name string, password ...string) (vfs.FileSystem, error) {
 	vfs.Tracef(fs, "OpenFile(%q)", name)
 	var pwd string
 	if len(password) > 0 {
 		pwd = password[0]
 	}
-	return open(name, func() (fileLike, string, error) {
+	return open(ctx, name, func(ctx context.Context) (fileLike, string, error) {
 		vfs.Tracef(fs, "OpenFile.open(%q)", name)
-		i, err := fs.Stat(name)
+		i, err := vfs.StatContext(ctx, fs, name)
 		if err != nil {
 			return nil, "", err
 		}
-		f, err := fs.Open(name)
+		f, err := vfs.OpenContext(ctx, fs, name)
 		if err != nil {
 			return nil, "", err
 		}
@@ -80,17 +129,10 @@ func OpenFile(fs vfs.FileSystem, name string, password ...string) (vfs.FileSyste
 	})
 }
 
-func open(name string, open func() (fileLike, string, error)) (vfs.FileSystem, error) {
-	z, err := openReadCloser(open)
+func open(ctx context.Context, name string, open func(context.Context) (fileLike, string, error)) (vfs.FileSystem, error) {
+	z, err := openReadCloser(ctx, open)
 	if err != nil {
-		switch err.Error() {
-		case "rardecode: bad header crc":
-			return nil, vfs.ErrNotSupported
-		case "rardecode: unsupported decoder version":
-			return nil, vfs.ErrNotSupported
-		default:
-			return nil, err
-		}
+		return nil, err
 	}
 	defer z.Close()
 
@@ -99,34 +141,57 @@ func open(name string, open func() (fileLike, string, error)) (vfs.FileSystem, e
 		open: open,
 	}
 
-	var f *rar.FileHeader
+	var (
+		f         *rar.FileHeader
+		redirects bool
+	)
 reading:
 	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
 		f, err = z.Next()
 		//vfs.Tracef(fs, "Open(): %+v %v", f, err)
-		if err != nil {
-			switch err.Error() {
-			case "rardecode: bad header crc":
-				return nil, vfs.ErrNotSupported
-			case "rardecode: unsupported decoder version":
-				return nil, vfs.ErrNotSupported
-			case io.EOF.Error():
-				break reading
-			default:
-				return nil, err
-			}
+		if err == io.EOF {
+			break reading
+		} else if err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: rarError(err, z.password)}
 		}
 		// Ignore special files
-		if f.Mode()&(os.ModeDevice|os.ModeSocket|os.ModeNamedPipe|os.ModeSymlink) != 0 {
+		if f.Mode()&(os.ModeDevice|os.ModeSocket|os.ModeNamedPipe) != 0 {
 			vfs.Tracef(fs, "Open(): ignore %q: %v", f.Name, f.Mode())
 			continue
 		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			// RAR stores the link destination as the file contents.
+			b, err := ioutil.ReadAll(z)
+			if err != nil {
+				return nil, &os.PathError{Op: "open", Path: name, Err: rarError(err, z.password)}
+			}
+			if fs.links == nil {
+				fs.links = make(map[string]string)
+			}
+			fs.links[f.Name] = string(b)
+			if len(b) == 0 {
+				// RAR 5 stores it in a redirection record instead.
+				redirects = true
+			}
+		}
 		if f.IsDir {
 			f.Name += "/"
+		} else if f.PackedSize == 0 && f.UnPackedSize > 0 {
+			// Entries without data may be redirections to another entry.
+			redirects = true
 		}
 		fs.list = append(fs.list, f)
 	}
 
+	if redirects {
+		if err = fs.readRedirections(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	sort.SliceStable(fs.list, func(i, j int) bool {
 		return fs.list[i].Name < fs.list[j].Name
 	})
@@ -141,13 +206,57 @@ reading:
 type readCloser struct {
 	*rar.Reader
 	io.Closer
+	password string
+}
+
+// decoderErrors maps the errors of the RAR decoder to their vfs equivalent.
+// The decoder doesn't export its errors, so they are matched by message.
+var decoderErrors = map[string]error{
+	"rardecode: RAR signature not found":                             vfs.ErrCorrupt,
+	"rardecode: bad header crc":                                      vfs.ErrCorrupt,
+	"rardecode: bad file checksum":                                   vfs.ErrCorrupt,
+	"rardecode: corrupt block header":                                vfs.ErrCorrupt,
+	"rardecode: corrupt file header":                                 vfs.ErrCorrupt,
+	"rardecode: corrupt decode header":                               vfs.ErrCorrupt,
+	"rardecode: corrupt ppm data":                                    vfs.ErrCorrupt,
+	"rardecode: corrupt encryption data":                             vfs.ErrCorrupt,
+	"rardecode: decoded file too short":                              vfs.ErrCorrupt,
+	"rardecode: huffman decode failed":                               vfs.ErrCorrupt,
+	"rardecode: invalid file block":                                  vfs.ErrCorrupt,
+	"rardecode: invalid huffman code length table":                   vfs.ErrCorrupt,
+	"rardecode: unexpected end of archive":                           vfs.ErrCorrupt,
+	"rardecode: archive continues in next volume":                    vfs.ErrNotSupported,
+	"rardecode: multiple decoders in a single archive not supported": vfs.ErrNotSupported,
+	"rardecode: unknown archive version":                             vfs.ErrNotSupported,
+	"rardecode: unknown decoder version":                             vfs.ErrNotSupported,
+	"rardecode: unknown encryption method":                           vfs.ErrNotSupported,
+	"rardecode: unsupported decoder version":                         vfs.ErrNotSupported,
+	"rardecode: volume version mistmatch":                            vfs.ErrNotSupported,
+	"rardecode: incorrect password":                                  vfs.ErrEncrypted,
+	"rardecode: decoder expected more data than is in packed file":   vfs.ErrCorrupt,
+}
+
+// rarError maps an error of the RAR decoder to its vfs equivalent.
+func rarError(err error, password string) error {
+	target, ok := decoderErrors[err.Error()]
+	if !ok {
+		return err
+	}
+	if target == vfs.ErrEncrypted && password == "" {
+		target = vfs.ErrPasswordRequired
+	}
+	return fmt.Errorf("%w: %v", target, err)
 }
 
-func openReadCloser(open func() (fileLike, string, error)) (*readCloser, error) {
-	f, p, err := open()
+func openReadCloser(ctx context.Context, open func(context.Context) (fileLike, string, error)) (*readCloser, error) {
+	f, p, err := open(ctx)
 	if err != nil {
 		return nil, err
 	}
+	f = trackedFile{f, vfs.TrackHandle(f.Name())}
+	if ctx.Done() != nil {
+		f = contextFile{f, ctx}
+	}
 
 	if _, err = f.Stat(); err != nil {
 		f.Close()
@@ -157,55 +266,98 @@ func openReadCloser(open func() (fileLike, string, error)) (*readCloser, error)
 	z, err := rar.NewReader(f, p)
 	if err != nil {
 		f.Close()
-		return nil, err
+		return nil, &os.PathError{Op: "open", Path: f.Name(), Err: rarError(err, p)}
 	}
 
-	return &readCloser{z, f}, nil
+	return &readCloser{z, f, p}, nil
 }
 
 type fileSystem struct {
-	name string
-	list []*rar.FileHeader
-	open func() (fileLike, string, error)
+	name      string
+	list      []*rar.FileHeader
+	links     map[string]string
+	hardlinks map[string]string
+	open      func(context.Context) (fileLike, string, error)
+	mu        sync.Mutex // guards tracer
+	tracer    vfs.Tracer
+}
+
+// readRedirections reads the redirection records in the archive: hard links
+// and file copies, which share their contents with an earlier entry, and the
+// destinations of RAR 5 symbolic links.
+func (fs *fileSystem) readRedirections(ctx context.Context) error {
+	f, _, err := fs.open(ctx)
+	if err != nil {
+		return err
+	}
+	f = trackedFile{f, vfs.TrackHandle(f.Name())}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	redirs, err := readRedirections(f, info.Size())
+	if err != nil {
+		return err
+	}
+	for name, redir := range redirs {
+		switch redir.kind {
+		case redirHardLink, redirFileCopy:
+			if fs.hardlinks == nil {
+				fs.hardlinks = make(map[string]string)
+			}
+			fs.hardlinks[name] = redir.target
+		case redirUnixSymlink, redirWindowsSymlink, redirJunction:
+			if target, ok := fs.links[name]; ok && target == "" {
+				if redir.kind != redirUnixSymlink {
+					redir.target = strings.Replace(redir.target, `\`, "/", -1)
+				}
+				fs.links[name] = redir.target
+			}
+		}
+	}
+	return nil
 }
 
 // lookup returns the smallest index of an entry with an exact match
 // for name, or an inexact match starting with name/. If there is no
 // such entry, the result is -1, false.
-func (fs fileSystem) lookup(name string) (index int, exact bool) {
+func (fs *fileSystem) lookup(name string) (index int, exact bool) {
+	list := fs.list
 	// look for exact match first (name comes before name/ in z)
-	i := sort.Search(len(fs.list), func(i int) bool {
-		return name <= fs.list[i].Name
+	i := sort.Search(len(list), func(i int) bool {
+		return name <= list[i].Name
 	})
-	if i >= len(fs.list) {
+	if i >= len(list) {
 		return -1, false
 	}
 	// 0 <= i < len(z)
-	if fs.list[i].Name == name {
+	if list[i].Name == name {
 		return i, true
 	}
 
 	// look for inexact match (must be in z[i:], if present)
-	fs.list = fs.list[i:]
+	list = list[i:]
 	name += "/"
-	j := sort.Search(len(fs.list), func(i int) bool {
-		return name <= fs.list[i].Name
+	j := sort.Search(len(list), func(i int) bool {
+		return name <= list[i].Name
 	})
-	if j >= len(fs.list) {
+	if j >= len(list) {
 		return -1, false
 	}
 	// 0 <= j < len(z)
-	if strings.HasPrefix(fs.list[j].Name, name) {
+	if strings.HasPrefix(list[j].Name, name) {
 		return i + j, false
 	}
 
 	return -1, false
 }
 
-func rarPath(name string) (string, error) {
+func rarPath(op, name string) (string, error) {
 	name = path.Clean(name)
 	if !path.IsAbs(name) {
-		return "", fmt.Errorf("stat: not an absolute path: %s", name)
+		return "", &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
 	}
 	return name[1:], nil // strip leading '/'
 }
@@ -214,112 +366,233 @@ func isRoot(abspath string) bool {
 	return path.Clean(abspath) == "/"
 }
 
-func (fs *fileSystem) stat(abspath string) (int, fileInfo, error) {
+func (fs *fileSystem) stat(op, abspath string) (int, fileInfo, error) {
 	vfs.Tracef(fs, "stat(%q)", abspath)
 	if isRoot(abspath) {
 		return 0, fileInfo{
-			name: "",
-			file: nil,
+			name:    "",
+			file:    nil,
+			archive: fs.name,
 		}, nil
 	}
-	rarpath, err := rarPath(abspath)
+	rarpath, err := rarPath(op, abspath)
 	if err != nil {
 		return 0, fileInfo{}, err
 	}
 	i, exact := fs.lookup(rarpath)
 	if i < 0 {
 		// rarpath has leading '/' stripped - print it explicitly
-		return -1, fileInfo{}, &os.PathError{Path: "/" + rarpath, Err: os.ErrNotExist}
+		return -1, fileInfo{}, &os.PathError{Op: op, Path: "/" + rarpath, Err: os.ErrNotExist}
 	}
 	_, name := path.Split(rarpath)
 	var file *rar.FileHeader
 	if exact {
 		file = fs.list[i] // exact match found - must be a file
 	}
-	return i, fileInfo{name, file}, nil
+	return i, fileInfo{name, file, fs.name}, nil
+}
+
+// hardlink returns the FileInfo for fi, resolving the size of hard links.
+func (fs *fileSystem) hardlink(fi fileInfo) os.FileInfo {
+	if fi.file == nil || len(fs.hardlinks) == 0 {
+		return fi
+	}
+	target, ok := fs.hardlinks[fi.file.Name]
+	if !ok {
+		return fi
+	}
+	i, exact := fs.lookup(target)
+	if !exact {
+		return fi // dangling link
+	}
+	return linkInfo{fi, fs.list[i]}
 }
 
 func (fs *fileSystem) Lstat(abspath string) (os.FileInfo, error) {
 	vfs.Tracef(fs, "Lstat(%q)", abspath)
-	_, fi, err := fs.stat(abspath)
-	return fi, err
+	_, fi, err := fs.stat("lstat", abspath)
+	if err != nil {
+		return nil, err
+	}
+	return fs.hardlink(fi), nil
 }
 
 func (fs *fileSystem) Stat(abspath string) (os.FileInfo, error) {
 	vfs.Tracef(fs, "Stat(%q)", abspath)
-	_, fi, err := fs.stat(abspath)
-	return fi, err
+	target, err := fs.follow(abspath)
+	if err != nil {
+		return nil, err
+	}
+	_, fi, err := fs.stat("stat", target)
+	if err != nil {
+		return nil, err
+	}
+	if path.Clean(target) != path.Clean(abspath) {
+		fi.name = path.Base(abspath)
+	}
+	return fs.hardlink(fi), nil
+}
+
+func (fs *fileSystem) Readlink(abspath string) (string, error) {
+	vfs.Tracef(fs, "Readlink(%q)", abspath)
+	_, fi, err := fs.stat("readlink", abspath)
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: abspath, Err: os.ErrInvalid}
+	}
+	target := fs.links[fi.file.Name]
+	if target == "" {
+		// The redirection record is missing, or in encrypted headers.
+		return "", &os.PathError{Op: "readlink", Path: abspath, Err: vfs.ErrNotSupported}
+	}
+	return target, nil
+}
+
+// follow returns abspath with all symbolic links resolved.
+func (fs *fileSystem) follow(abspath string) (string, error) {
+	if len(fs.links) == 0 {
+		return abspath, nil
+	}
+	return vfs.EvalSymlinks(fs, abspath)
 }
 
+// emulatedRSC emulates io.Seeker for a compressed entry by reopening the
+// entry and skipping ahead to the requested offset.
 type emulatedRSC struct {
-	io.Closer
 	io.Reader
-	name string
-	open func() (fileLike, string, error)
+	io.Closer
+	name   string // full path of the entry, for errors
+	size   int64
+	offset int64
+	open   func() (io.Reader, io.Closer, error)
 }
 
-func (rsc emulatedRSC) Close() error {
-	return rsc.Closer.Close()
+func (rsc *emulatedRSC) Read(p []byte) (n int, err error) {
+	n, err = rsc.Reader.Read(p)
+	rsc.offset += int64(n)
+	return
 }
 
-func (rsc emulatedRSC) Read(p []byte) (n int, err error) {
-	return rsc.Reader.Read(p)
-}
+func (rsc *emulatedRSC) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rsc.offset
+	case io.SeekEnd:
+		offset += rsc.size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: rsc.name, Err: os.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: rsc.name, Err: os.ErrInvalid}
+	}
 
-func (rsc emulatedRSC) Seek(offset int64, whence int) (int64, error) {
-	if whence == 0 && offset == 0 {
-		z, _, err := rsc.open()
+	if offset < rsc.offset {
+		r, c, err := rsc.open()
 		if err != nil {
 			return 0, err
 		}
 		rsc.Closer.Close()
-		rsc.Closer = z
-		return 0, nil
+		rsc.Reader, rsc.Closer, rsc.offset = r, c, 0
+	}
+	if _, err := io.CopyN(ioutil.Discard, rsc, offset-rsc.offset); err != nil && err != io.EOF {
+		return 0, err
+	}
+	rsc.offset = offset
+	return offset, nil
+}
+
+// openEntry opens the archive and returns a reader for the named entry.
+func (fs *fileSystem) openEntry(ctx context.Context, name string) (io.Reader, io.Closer, error) {
+	z, err := openReadCloser(ctx, fs.open)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			z.Close()
+			return nil, nil, err
+		}
+		h, err := z.Next()
+		if err == io.EOF {
+			z.Close()
+			return nil, nil, &os.PathError{Op: "open", Path: "/" + name, Err: os.ErrNotExist}
+		} else if err != nil {
+			z.Close()
+			return nil, nil, &os.PathError{Op: "open", Path: "/" + name, Err: rarError(err, z.password)}
+		}
+		if h.Name == name {
+			return z, z, nil
+		}
 	}
-	return 0, fmt.Errorf("unsupported Seek in %s", rsc.name)
 }
 
 func (fs *fileSystem) Open(abspath string) (vfs.ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), abspath)
+}
+
+func (fs *fileSystem) OpenContext(ctx context.Context, abspath string) (vfs.ReadSeekCloser, error) {
 	vfs.Tracef(fs, "Open(%q)", abspath)
-	_, fi, err := fs.stat(abspath)
+	abspath, err := fs.follow(abspath)
+	if err != nil {
+		return nil, err
+	}
+	_, fi, err := fs.stat("open", abspath)
 	if err != nil {
 		return nil, err
 	}
 	if fi.IsDir() {
-		return nil, fmt.Errorf("rarfs: %s is a directory", abspath)
+		return nil, &os.PathError{Op: "open", Path: path.Clean("/" + abspath), Err: vfs.ErrIsDir}
 	}
 
-	z, err := openReadCloser(fs.open)
+	name, info := fi.file.Name, fs.hardlink(fi)
+	if link, ok := info.(linkInfo); ok {
+		name = link.target.Name
+	}
+	r, c, err := fs.openEntry(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	defer z.Close()
+	return &emulatedRSC{
+		Reader: r,
+		Closer: c,
+		name:   path.Clean("/" + abspath),
+		size:   info.Size(),
+		open: func() (io.Reader, io.Closer, error) {
+			return fs.openEntry(ctx, name)
+		},
+	}, nil
+}
 
-	var h *rar.FileHeader
-	for {
-		if h, err = z.Next(); err != nil {
-			return nil, err
-		}
-		if h.Name == fi.name {
-			break
-		}
+func (fs *fileSystem) StatContext(ctx context.Context, abspath string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return emulatedRSC{
-		Reader: z,
-		Closer: z,
-		name:   h.Name,
-		open:   fs.open,
-	}, nil
+	return fs.Stat(abspath)
+}
+
+func (fs *fileSystem) ReaddirContext(ctx context.Context, abspath string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.Readdir(abspath)
 }
 
 func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 	vfs.Tracef(fs, "Readdir(%q)", abspath)
-	i, fi, err := fs.stat(abspath)
+	abspath, err := fs.follow(abspath)
+	if err != nil {
+		return nil, err
+	}
+	i, fi, err := fs.stat("readdir", abspath)
 	if err != nil {
 		return nil, err
 	}
 	if !fi.IsDir() {
-		return nil, fmt.Errorf("rarfs: %s is not a directory", abspath)
+		return nil, &os.PathError{Op: "readdir", Path: path.Clean("/" + abspath), Err: vfs.ErrNotDir}
 	}
 
 	var list []os.FileInfo
@@ -332,7 +605,7 @@ func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 	if isRoot(abspath) {
 		dirname = ""
 	} else {
-		rarpath, err := rarPath(abspath)
+		rarpath, err := rarPath("readdir", abspath)
 		if err != nil {
 			return nil, err
 		}
@@ -357,7 +630,7 @@ func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 		// by determining the (fs.list) range of local directory entries
 		// (via two binary searches).
 		if name != prevname {
-			list = append(list, fileInfo{name, file})
+			list = append(list, fs.hardlink(fileInfo{name, file, fs.name}))
 			prevname = name
 		}
 	}
@@ -365,6 +638,28 @@ func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 	return list, nil
 }
 
+// Tracer returns the Tracer set with SetTracer.
+func (fs *fileSystem) Tracer() vfs.Tracer {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.tracer
+}
+
+// SetTracer sets the Tracer for the operations on the archive.
+func (fs *fileSystem) SetTracer(t vfs.Tracer) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.tracer = t
+}
+
 func (fs *fileSystem) String() string {
 	return fmt.Sprintf(`rarfs(%s)`, fs.name)
 }
+
+var (
+	_ vfs.ContextFileSystem  = (*fileSystem)(nil)
+	_ vfs.HardLinkInfo       = linkInfo{}
+	_ vfs.MetadataInfo       = fileInfo{}
+	_ vfs.ReadlinkFileSystem = (*fileSystem)(nil)
+	_ vfs.TracerFileSystem   = (*fileSystem)(nil)
+)
@@ -1,11 +1,16 @@
 package rarfs_test
 
 import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
 	"path"
 	"path/filepath"
 	"testing"
 
 	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
 	"textmodes.com/vfs/rarfs"
 )
 
@@ -48,3 +53,170 @@ func testRecursive(t *testing.T, fs vfs.FileSystem, dir string) {
 		}
 	}
 }
+
+func TestHardLink(t *testing.T) {
+	fs, err := rarfs.Open("../testdata/rar/rar5-hlink.rar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/stest2.txt", "/stest3.txt"} {
+		info, err := fs.Stat(name)
+		if err != nil {
+			t.Fatalf("Stat(%q): %v", name, err)
+		}
+		if link, ok := info.(vfs.HardLinkInfo); !ok {
+			t.Errorf("Stat(%q): expected a vfs.HardLinkInfo, got %T", name, info)
+		} else if want := "/stest1.txt"; link.HardLink() != want {
+			t.Errorf("Stat(%q): expected link to %q, got %q", name, want, link.HardLink())
+		}
+
+		f, err := fs.Open(name)
+		if err != nil {
+			t.Fatalf("Open(%q): %v", name, err)
+		}
+		b, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("Open(%q): %v", name, err)
+		}
+		if int64(len(b)) != info.Size() {
+			t.Errorf("Open(%q): expected %d bytes, got %d", name, info.Size(), len(b))
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	tests := []struct {
+		password []string
+		want     error
+	}{
+		{nil, vfs.ErrPasswordRequired},
+		{[]string{"wrong"}, vfs.ErrEncrypted},
+	}
+	for _, test := range tests {
+		_, err := rarfs.Open("../testdata/rar/rar5-psw.rar", test.password...)
+		if !errors.Is(err, test.want) {
+			t.Errorf("Open with password %q: expected %v, got %v", test.password, test.want, err)
+		}
+	}
+
+	if _, err := rarfs.Open("../testdata/rar/unsupported/rar15-comment.rar"); !errors.Is(err, vfs.ErrCorrupt) {
+		t.Errorf("expected %v, got %v", vfs.ErrCorrupt, err)
+	}
+}
+
+// rar5Entry is an entry of an archive built by rar5Archive: a stored file with
+// data, or a symbolic link to link.
+type rar5Entry struct {
+	name, data, link string
+}
+
+// rar5Archive returns a RAR 5 archive with the entries, storing link
+// destinations in redirection records like RAR 5 does.
+func rar5Archive(entries ...rar5Entry) []byte {
+	vint := func(b []byte, v uint64) []byte {
+		var buf [binary.MaxVarintLen64]byte
+		return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+	}
+	block := func(kind, flags uint64, fields, extra []byte, data string) []byte {
+		h := vint(vint(nil, kind), flags)
+		if flags&0x0001 != 0 {
+			h = vint(h, uint64(len(extra)))
+		}
+		if flags&0x0002 != 0 {
+			h = vint(h, uint64(len(data)))
+		}
+		h = append(append(h, fields...), extra...)
+		h = append(vint(nil, uint64(len(h))), h...)
+		b := make([]byte, 4, 4+len(h)+len(data))
+		binary.LittleEndian.PutUint32(b, crc32.ChecksumIEEE(h))
+		return append(append(b, h...), data...)
+	}
+
+	archive := []byte("Rar!\x1a\x07\x01\x00")
+	archive = append(archive, block(1, 0, vint(nil, 0), nil, "")...)
+	for _, e := range entries {
+		var (
+			flags  uint64
+			fields []byte
+			extra  []byte
+		)
+		if e.link == "" {
+			flags = 0x0002
+			fields = vint(fields, 0x0004) // CRC32 present
+			fields = vint(fields, uint64(len(e.data)))
+			fields = vint(fields, 0100644)
+			var sum [4]byte
+			binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE([]byte(e.data)))
+			fields = append(fields, sum[:]...)
+		} else {
+			flags = 0x0001
+			fields = vint(fields, 0)
+			fields = vint(fields, 0)
+			fields = vint(fields, 0120777)
+			record := vint(vint(vint(nil, 5), 1), 0) // redirection, Unix symlink
+			record = append(vint(record, uint64(len(e.link))), e.link...)
+			extra = append(vint(nil, uint64(len(record))), record...)
+		}
+		fields = vint(fields, 0) // stored
+		fields = vint(fields, 1) // Unix
+		fields = append(vint(fields, uint64(len(e.name))), e.name...)
+		archive = append(archive, block(2, flags, fields, extra, e.data)...)
+	}
+	return append(archive, block(5, 0, vint(nil, 0), nil, "")...)
+}
+
+func TestSymlinkRAR5(t *testing.T) {
+	archive := rar5Archive(
+		rar5Entry{name: "dir/file", data: "contents"},
+		rar5Entry{name: "link", link: "dir/file"},
+	)
+	fs, err := rarfs.OpenFile(mapfs.New(map[string]string{"a.rar": string(archive)}), "/a.rar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := vfs.Readlink(fs, "/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "dir/file"; target != want {
+		t.Errorf("expected link to %q, got %q", want, target)
+	}
+	f, err := fs.Open("/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "contents" {
+		t.Errorf("expected %q, got %q", "contents", b)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	archive := rar5Archive(rar5Entry{name: "file", data: "contents"})
+	fs, err := rarfs.OpenFile(mapfs.New(map[string]string{"a.rar": string(archive)}), "/a.rar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := fs.Stat("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := vfs.MetadataOf(info)
+	if want := "/a.rar"; md.Archive != want {
+		t.Errorf("expected archive %q, got %q", want, md.Archive)
+	}
+	if want := int64(len("contents")); md.CompressedSize != want {
+		t.Errorf("expected compressed size %d, got %d", want, md.CompressedSize)
+	}
+	if md.Uid != -1 || md.Gid != -1 {
+		t.Errorf("expected unknown owner, got %d:%d", md.Uid, md.Gid)
+	}
+}
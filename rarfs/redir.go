@@ -0,0 +1,183 @@
+package rarfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"textmodes.com/vfs"
+)
+
+// RAR 5 redirection types, stored in the file redirection record.
+const (
+	redirUnixSymlink    = 1
+	redirWindowsSymlink = 2
+	redirJunction       = 3
+	redirHardLink       = 4
+	redirFileCopy       = 5
+)
+
+// redirection is a file redirection record.
+type redirection struct {
+	kind   int
+	target string
+}
+
+// maxHeaderSize is the maximum size of a RAR 5 header.
+const maxHeaderSize = 2 << 20
+
+var (
+	rar5Signature = []byte("Rar!\x1a\x07\x01\x00")
+
+	errBadVint     = fmt.Errorf("rarfs: bad variable length integer: %w", vfs.ErrCorrupt)
+	errBadHeader   = fmt.Errorf("rarfs: bad header size: %w", vfs.ErrCorrupt)
+	errBadDataSize = fmt.Errorf("rarfs: bad data size: %w", vfs.ErrCorrupt)
+)
+
+// readRedirections scans the headers of a RAR 5 archive for file entries with
+// a redirection record, returning a map of entry names to their redirection.
+// The decoder skips these records, so we have to parse the headers ourselves.
+// Archives with encrypted headers yield no redirections. Size is the size of
+// the archive.
+func readRedirections(r io.ReaderAt, size int64) (map[string]redirection, error) {
+	var (
+		redirs = make(map[string]redirection)
+		off    = int64(len(rar5Signature))
+		sig    = make([]byte, len(rar5Signature))
+	)
+	if _, err := r.ReadAt(sig, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(sig, rar5Signature) {
+		return redirs, nil // RAR 1.5 archives have no redirection records
+	}
+
+	for {
+		// Header CRC32 and size.
+		var head [4 + binary.MaxVarintLen64]byte
+		n, err := r.ReadAt(head[:], off)
+		if n < 5 {
+			if err == io.EOF {
+				return redirs, nil
+			}
+			return nil, err
+		}
+		hsize, m := binary.Uvarint(head[4:n])
+		if m <= 0 {
+			return nil, errBadVint
+		}
+		off += int64(4 + m)
+		if hsize > maxHeaderSize || hsize > uint64(size-off) {
+			return nil, errBadHeader
+		}
+
+		h := readBuf(make([]byte, hsize))
+		if _, err = r.ReadAt(h, off); err != nil {
+			return nil, err
+		}
+		off += int64(hsize)
+
+		var (
+			kind      = h.uvarint()
+			flags     = h.uvarint()
+			extraSize uint64
+			dataSize  uint64
+		)
+		if flags&0x0001 != 0 {
+			extraSize = h.uvarint()
+		}
+		if flags&0x0002 != 0 {
+			dataSize = h.uvarint()
+		}
+		if h == nil || extraSize > uint64(len(h)) {
+			return nil, errBadVint
+		}
+		if dataSize > uint64(size-off) {
+			return nil, errBadDataSize
+		}
+		off += int64(dataSize)
+
+		switch kind {
+		case 2: // file
+			extra := h[len(h)-int(extraSize):]
+			if name, redir, ok := parseFileRedirection(h, extra); ok {
+				redirs[name] = redir
+			}
+		case 4, 5: // archive encryption, end of archive
+			return redirs, nil
+		}
+	}
+}
+
+// parseFileRedirection parses a file header and its extra area.
+func parseFileRedirection(h, extra readBuf) (name string, redir redirection, ok bool) {
+	fileFlags := h.uvarint()
+	h.uvarint() // unpacked size
+	h.uvarint() // attributes
+	if fileFlags&0x0002 != 0 {
+		h.skip(4) // modification time
+	}
+	if fileFlags&0x0004 != 0 {
+		h.skip(4) // data CRC32
+	}
+	h.uvarint() // compression information
+	h.uvarint() // host OS
+	if name, ok = h.string(); !ok {
+		return "", redirection{}, false
+	}
+
+	for len(extra) > 0 {
+		size := extra.uvarint()
+		if extra == nil || size > uint64(len(extra)) {
+			return "", redirection{}, false
+		}
+		record := extra[:size]
+		extra = extra[size:]
+		if record.uvarint() != 5 { // file system redirection
+			continue
+		}
+		redir.kind = int(record.uvarint())
+		record.uvarint() // flags
+		if redir.target, ok = record.string(); ok {
+			return name, redir, true
+		}
+	}
+	return "", redirection{}, false
+}
+
+// readBuf is a RAR 5 header being parsed. It is set to nil once a read runs
+// past its end.
+type readBuf []byte
+
+func (b *readBuf) uvarint() uint64 {
+	if *b == nil {
+		return 0
+	}
+	v, n := binary.Uvarint(*b)
+	if n <= 0 {
+		*b = nil
+		return 0
+	}
+	*b = (*b)[n:]
+	return v
+}
+
+func (b *readBuf) skip(n int) {
+	if len(*b) < n {
+		*b = nil
+		return
+	}
+	*b = (*b)[n:]
+}
+
+func (b *readBuf) string() (string, bool) {
+	n := b.uvarint()
+	if *b == nil || n > uint64(len(*b)) {
+		*b = nil
+		return "", false
+	}
+	s := string((*b)[:n])
+	*b = (*b)[n:]
+	return s, true
+}
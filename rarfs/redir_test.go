@@ -0,0 +1,29 @@
+package rarfs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"textmodes.com/vfs"
+)
+
+func TestReadRedirectionsCorrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		pad  int
+	}{
+		{"header larger than archive", []byte{0, 0, 0, 0, 0x80, 0x01, 1, 0}, 0},
+		{"header above limit", []byte{0, 0, 0, 0, 0x81, 0x80, 0x80, 0x01}, maxHeaderSize + 1},
+		{"bad size", []byte{0, 0, 0, 0, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80}, 0},
+	}
+	for _, test := range tests {
+		archive := append(append([]byte(nil), rar5Signature...), test.head...)
+		archive = append(archive, make([]byte, test.pad)...)
+		_, err := readRedirections(bytes.NewReader(archive), int64(len(archive)))
+		if !errors.Is(err, vfs.ErrCorrupt) {
+			t.Errorf("%s: expected %v, got %v", test.name, vfs.ErrCorrupt, err)
+		}
+	}
+}
@@ -0,0 +1,506 @@
+package vfs
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RecordingFileSystem is a FileSystem recording the calls made to it, see
+// Record.
+type RecordingFileSystem interface {
+	ContextFileSystem
+
+	// Save writes the calls recorded so far to w, in the format read by
+	// Replay.
+	Save(w io.Writer) error
+}
+
+// Record returns a FileSystem that records the results of all calls to fs,
+// including the parts of opened files that are read and the errors reading
+// them, so they can be replayed without fs with Replay. Reading parts of a
+// replayed file that weren't read while recording fails with an error
+// wrapping ErrNotRecorded.
+func Record(fs FileSystem) RecordingFileSystem {
+	return &recordingFileSystem{
+		fs: fs,
+		session: &session{
+			FS:    fs.String(),
+			Calls: make(map[string]*recordedCall),
+		},
+	}
+}
+
+// Replay returns a FileSystem serving a session saved by a
+// RecordingFileSystem. Calls that weren't recorded fail with an error
+// wrapping ErrNotRecorded.
+func Replay(r io.Reader) (FileSystem, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var s session
+	if err = json.NewDecoder(zr).Decode(&s); err != nil {
+		return nil, err
+	}
+	return &replayFileSystem{&s}, nil
+}
+
+// session is the saved form of the calls recorded by a RecordingFileSystem.
+type session struct {
+	FS    string                   `json:"fs"`
+	Calls map[string]*recordedCall `json:"calls"` // by callKey
+}
+
+func callKey(op, name string) string {
+	return op + " " + path.Clean("/"+name)
+}
+
+// recordedCall is the result of a call.
+type recordedCall struct {
+	Info    *recordedInfo    `json:"info,omitempty"`
+	Infos   []*recordedInfo  `json:"infos,omitempty"`
+	Target  string           `json:"target,omitempty"`
+	Content *recordedContent `json:"content,omitempty"`
+	Err     *recordedError   `json:"err,omitempty"`
+}
+
+// recordedContent is what was read from a file, by all the times it was
+// opened.
+type recordedContent struct {
+	Chunks []*recordedChunk `json:"chunks,omitempty"` // sorted, neither overlapping nor adjacent
+	Size   *int64           `json:"size,omitempty"`   // if the end was reached
+	Err    *recordedError   `json:"err,omitempty"`    // of a read
+	ErrOff int64            `json:"err_off,omitempty"`
+}
+
+// recordedChunk is a contiguous part of a file.
+type recordedChunk struct {
+	Off  int64  `json:"off"`
+	Data []byte `json:"data"`
+}
+
+func (c *recordedChunk) end() int64 {
+	return c.Off + int64(len(c.Data))
+}
+
+// add adds a copy of data read at off.
+func (c *recordedContent) add(off int64, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	merged := &recordedChunk{off, append([]byte(nil), data...)}
+	chunks := c.Chunks[:0:0]
+	for _, chunk := range c.Chunks {
+		if chunk.end() < merged.Off || chunk.Off > merged.end() {
+			chunks = append(chunks, chunk)
+			continue
+		}
+		start, end := chunk.Off, chunk.end()
+		if merged.Off < start {
+			start = merged.Off
+		}
+		if merged.end() > end {
+			end = merged.end()
+		}
+		buf := make([]byte, end-start)
+		copy(buf[chunk.Off-start:], chunk.Data)
+		copy(buf[merged.Off-start:], merged.Data)
+		merged = &recordedChunk{start, buf}
+	}
+	chunks = append(chunks, merged)
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Off < chunks[j].Off })
+	c.Chunks = chunks
+}
+
+// chunk returns the chunk containing off, or nil.
+func (c *recordedContent) chunk(off int64) *recordedChunk {
+	i := sort.Search(len(c.Chunks), func(i int) bool { return c.Chunks[i].end() > off })
+	if i < len(c.Chunks) && c.Chunks[i].Off <= off {
+		return c.Chunks[i]
+	}
+	return nil
+}
+
+// recordedInfo is a recorded os.FileInfo.
+type recordedInfo struct {
+	Name     string      `json:"name"`
+	Size     int64       `json:"size"`
+	Mode     os.FileMode `json:"mode"`
+	ModTime  time.Time   `json:"mtime"`
+	HardLink string      `json:"link,omitempty"`
+	Metadata *Metadata   `json:"metadata,omitempty"`
+}
+
+func newRecordedInfo(info os.FileInfo) *recordedInfo {
+	r := &recordedInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+	}
+	if info, ok := info.(HardLinkInfo); ok {
+		r.HardLink = info.HardLink()
+	}
+	if md := MetadataOf(info); !reflect.DeepEqual(md, Metadata{Uid: -1, Gid: -1}) {
+		r.Metadata = &md
+	}
+	return r
+}
+
+// replayedInfo is the os.FileInfo of a recordedInfo.
+type replayedInfo struct {
+	r *recordedInfo
+}
+
+func (info replayedInfo) Name() string       { return info.r.Name }
+func (info replayedInfo) Size() int64        { return info.r.Size }
+func (info replayedInfo) Mode() os.FileMode  { return info.r.Mode }
+func (info replayedInfo) ModTime() time.Time { return info.r.ModTime }
+func (info replayedInfo) IsDir() bool        { return info.r.Mode.IsDir() }
+func (info replayedInfo) Sys() interface{}   { return nil }
+func (info replayedInfo) HardLink() string   { return info.r.HardLink }
+
+func (info replayedInfo) Metadata() Metadata {
+	if info.r.Metadata == nil {
+		return Metadata{Uid: -1, Gid: -1}
+	}
+	return *info.r.Metadata
+}
+
+// recordedError is a recorded error. It is replayed with the same message,
+// and wrapping the error of the same kind, see errorKind.
+type recordedError struct {
+	Op   string `json:"op,omitempty"`
+	Path string `json:"path,omitempty"`
+	Msg  string `json:"msg"`
+	Kind string `json:"kind"`
+}
+
+// errorKinds are the errors replayed for the kinds of errors.
+var errorKinds = map[string]error{
+	"canceled":      context.Canceled,
+	"not_exist":     os.ErrNotExist,
+	"permission":    os.ErrPermission,
+	"is_dir":        ErrIsDir,
+	"not_dir":       ErrNotDir,
+	"corrupt":       ErrCorrupt,
+	"encrypted":     ErrEncrypted,
+	"not_supported": ErrNotSupported,
+	"symlink_loop":  ErrSymlinkLoop,
+	"too_large":     ErrTooLarge,
+	"ambiguous":     ErrAmbiguous,
+}
+
+func newRecordedError(err error) *recordedError {
+	r := &recordedError{Msg: err.Error(), Kind: errorKind(err)}
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		r.Op, r.Path, r.Msg = pe.Op, pe.Path, pe.Err.Error()
+	}
+	return r
+}
+
+// err returns the error to replay.
+func (r *recordedError) err() error {
+	var err error = replayedError{r.Msg, errorKinds[r.Kind]}
+	switch r.Kind {
+	case "not_exist", "permission":
+		// Keep os.IsNotExist and os.IsPermission working.
+		err = errorKinds[r.Kind]
+	}
+	if r.Op != "" {
+		err = &os.PathError{Op: r.Op, Path: r.Path, Err: err}
+	}
+	return err
+}
+
+type replayedError struct {
+	msg  string
+	kind error
+}
+
+func (e replayedError) Error() string { return e.msg }
+func (e replayedError) Unwrap() error { return e.kind }
+
+type recordingFileSystem struct {
+	fs FileSystem
+
+	mu      sync.Mutex
+	session *session
+}
+
+// record records the result of a call, unless it was canceled.
+func (fs *recordingFileSystem) record(op, name string, call *recordedCall, err error) {
+	if err != nil {
+		if errorKind(err) == "canceled" {
+			return
+		}
+		call.Err = newRecordedError(err)
+	}
+	fs.mu.Lock()
+	fs.session.Calls[callKey(op, name)] = call
+	fs.mu.Unlock()
+}
+
+func (fs *recordingFileSystem) Save(w io.Writer) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(fs.session); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (fs *recordingFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs *recordingFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	f, err := OpenContext(ctx, fs.fs, name)
+	if err != nil {
+		fs.record("open", name, new(recordedCall), err)
+		return nil, err
+	}
+
+	// Add to the content read when the file was opened before.
+	fs.mu.Lock()
+	key := callKey("open", name)
+	call := fs.session.Calls[key]
+	if call == nil || call.Content == nil {
+		call = &recordedCall{Content: new(recordedContent)}
+		fs.session.Calls[key] = call
+	}
+	fs.mu.Unlock()
+	return &recordingFile{f: f, fs: fs, content: call.Content}, nil
+}
+
+func (fs *recordingFileSystem) Lstat(name string) (os.FileInfo, error) {
+	info, err := fs.fs.Lstat(name)
+	fs.recordInfo("lstat", name, info, err)
+	return info, err
+}
+
+func (fs *recordingFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.StatContext(context.Background(), name)
+}
+
+func (fs *recordingFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := StatContext(ctx, fs.fs, name)
+	fs.recordInfo("stat", name, info, err)
+	return info, err
+}
+
+func (fs *recordingFileSystem) recordInfo(op, name string, info os.FileInfo, err error) {
+	call := new(recordedCall)
+	if err == nil {
+		call.Info = newRecordedInfo(info)
+	}
+	fs.record(op, name, call, err)
+}
+
+func (fs *recordingFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs *recordingFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	infos, err := ReaddirContext(ctx, fs.fs, name)
+	call := new(recordedCall)
+	for _, info := range infos {
+		call.Infos = append(call.Infos, newRecordedInfo(info))
+	}
+	fs.record("readdir", name, call, err)
+	return infos, err
+}
+
+func (fs *recordingFileSystem) Readlink(name string) (string, error) {
+	target, err := Readlink(fs.fs, name)
+	fs.record("readlink", name, &recordedCall{Target: target}, err)
+	return target, err
+}
+
+func (fs *recordingFileSystem) String() string {
+	return fs.fs.String()
+}
+
+// recordingFile records the reads of a file opened by a
+// recordingFileSystem.
+type recordingFile struct {
+	f       ReadSeekCloser
+	fs      *recordingFileSystem
+	content *recordedContent // guarded by fs.mu
+	offset  int64
+}
+
+func (f *recordingFile) Read(p []byte) (int, error) {
+	n, err := f.f.Read(p)
+	f.fs.mu.Lock()
+	f.content.add(f.offset, p[:n])
+	f.offset += int64(n)
+	switch {
+	case err == io.EOF:
+		size := f.offset
+		f.content.Size = &size
+	case err != nil && errorKind(err) != "canceled":
+		f.content.Err = newRecordedError(err)
+		f.content.ErrOff = f.offset
+	}
+	f.fs.mu.Unlock()
+	return n, err
+}
+
+func (f *recordingFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.f.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	f.offset = pos
+	if whence == io.SeekEnd {
+		size := pos - offset
+		f.fs.mu.Lock()
+		f.content.Size = &size
+		f.fs.mu.Unlock()
+	}
+	return pos, nil
+}
+
+func (f *recordingFile) Close() error {
+	return f.f.Close()
+}
+
+// replayedFile is a file replaying a recordedContent.
+type replayedFile struct {
+	name    string
+	content *recordedContent
+	offset  int64
+}
+
+func (f *replayedFile) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	c := f.content
+	switch chunk := c.chunk(f.offset); {
+	case chunk != nil:
+		n := copy(p, chunk.Data[f.offset-chunk.Off:])
+		f.offset += int64(n)
+		return n, nil
+	case c.Size != nil && f.offset >= *c.Size:
+		return 0, io.EOF
+	case c.Err != nil && f.offset >= c.ErrOff:
+		return 0, c.Err.err()
+	}
+	return 0, &os.PathError{Op: "read", Path: f.name, Err: ErrNotRecorded}
+}
+
+func (f *replayedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		if f.content.Size == nil {
+			return 0, &os.PathError{Op: "seek", Path: f.name, Err: ErrNotRecorded}
+		}
+		offset += *f.content.Size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *replayedFile) Close() error {
+	return nil
+}
+
+type replayFileSystem struct {
+	session *session
+}
+
+// call returns the recorded result of a call.
+func (fs *replayFileSystem) call(op, name string) (*recordedCall, error) {
+	call, ok := fs.session.Calls[callKey(op, name)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: ErrNotRecorded}
+	}
+	if call.Err != nil {
+		return nil, call.Err.err()
+	}
+	return call, nil
+}
+
+func (fs *replayFileSystem) Open(name string) (ReadSeekCloser, error) {
+	call, err := fs.call("open", name)
+	if err != nil {
+		return nil, err
+	}
+	content := call.Content
+	if content == nil {
+		content = new(recordedContent)
+	}
+	return &replayedFile{name: name, content: content}, nil
+}
+
+func (fs *replayFileSystem) Lstat(name string) (os.FileInfo, error) {
+	call, err := fs.call("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return replayedInfo{call.Info}, nil
+}
+
+func (fs *replayFileSystem) Stat(name string) (os.FileInfo, error) {
+	call, err := fs.call("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return replayedInfo{call.Info}, nil
+}
+
+func (fs *replayFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	call, err := fs.call("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, len(call.Infos))
+	for i, info := range call.Infos {
+		infos[i] = replayedInfo{info}
+	}
+	return infos, nil
+}
+
+func (fs *replayFileSystem) Readlink(name string) (string, error) {
+	call, err := fs.call("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	return call.Target, nil
+}
+
+func (fs *replayFileSystem) String() string {
+	return "replay of " + fs.session.FS
+}
+
+var (
+	_ RecordingFileSystem = (*recordingFileSystem)(nil)
+	_ ReadlinkFileSystem  = (*recordingFileSystem)(nil)
+	_ ReadlinkFileSystem  = (*replayFileSystem)(nil)
+	_ HardLinkInfo        = replayedInfo{}
+	_ MetadataInfo        = replayedInfo{}
+)
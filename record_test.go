@@ -0,0 +1,133 @@
+package vfs_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/autofs"
+	"textmodes.com/vfs/mapfs"
+)
+
+// walkAll walks fs, reading all regular files, and returns a description of
+// what it found.
+func walkAll(t *testing.T, fs vfs.FileSystem) []string {
+	var out []string
+	err := vfs.Walk(fs, "/", func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			out = append(out, fmt.Sprintf("%s error %s", name, errorKind(err)))
+			return nil
+		}
+		line := fmt.Sprintf("%s %v %d %v", name, info.Mode(), info.Size(), info.ModTime().UTC())
+		if info.Mode().IsRegular() {
+			f, err := fs.Open(name)
+			if err != nil {
+				line += " open error " + errorKind(err)
+			} else {
+				b, err := ioutil.ReadAll(f)
+				f.Close()
+				line += fmt.Sprintf(" %q %v", b, err)
+			}
+		}
+		out = append(out, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func errorKind(err error) string {
+	for _, kind := range []error{os.ErrNotExist, vfs.ErrCorrupt, vfs.ErrNotSupported, vfs.ErrEncrypted, vfs.ErrIsDir} {
+		if errors.Is(err, kind) {
+			return kind.Error()
+		}
+	}
+	return "other"
+}
+
+func TestRecordReplay(t *testing.T) {
+	afs, err := autofs.New("testdata/tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := vfs.Record(afs)
+	want := walkAll(t, rec)
+
+	var buf bytes.Buffer
+	if err = rec.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := vfs.Replay(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := walkAll(t, fs)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected\n%q\ngot\n%q", want, got)
+	}
+
+	if _, err = fs.Stat("/not/recorded"); !errors.Is(err, vfs.ErrNotRecorded) {
+		t.Errorf("expected ErrNotRecorded, got %v", err)
+	}
+}
+
+func TestRecordReads(t *testing.T) {
+	// The first read of /a is short, the second one fails.
+	ffs, err := vfs.Faulty(mapfs.New(map[string]string{"a": "abcdef", "b": "b"}), vfs.FaultRules{Rules: []vfs.FaultRule{
+		{Op: "read", Path: "/a", Nth: 2, Err: vfs.ErrCorrupt},
+		{Op: "read", Path: "/a", ShortRead: 2},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := vfs.Record(ffs)
+	read := func(fs vfs.FileSystem) (string, error) {
+		f, err := fs.Open("/a")
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		b, err := ioutil.ReadAll(f)
+		return string(b), err
+	}
+	if b, err := read(rec); b != "ab" || !errors.Is(err, vfs.ErrCorrupt) {
+		t.Fatalf("expected %q and ErrCorrupt, got %q, %v", "ab", b, err)
+	}
+	f, err := rec.Open("/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var buf bytes.Buffer
+	if err = rec.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := vfs.Replay(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Open succeeds, and the reads are replayed.
+	if b, err := read(fs); b != "ab" || !errors.Is(err, vfs.ErrCorrupt) {
+		t.Errorf("expected %q and ErrCorrupt, got %q, %v", "ab", b, err)
+	}
+	if f, err = fs.Open("/b"); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.Read(make([]byte, 1)); !errors.Is(err, vfs.ErrNotRecorded) {
+		t.Errorf("expected ErrNotRecorded, got %v", err)
+	}
+	if _, err = f.Seek(0, io.SeekEnd); !errors.Is(err, vfs.ErrNotRecorded) {
+		t.Errorf("expected ErrNotRecorded, got %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package vfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Policy configures Restrict. The patterns use the syntax of Match and are
+// matched against absolute paths, such as "/private" or "**/.git".
+type Policy struct {
+	// Deny are the patterns of paths that appear not to exist, together
+	// with everything below them.
+	Deny []string
+
+	// Hide are the patterns of paths left out of directory listings. Hidden
+	// paths can still be accessed by name.
+	Hide []string
+
+	// ModeMask masks the permission bits of the reported file modes, for
+	// example 0555 to present a read-only view. If zero, modes are
+	// reported unchanged.
+	ModeMask os.FileMode
+
+	// MaxFileSize is the size of the largest file that can be opened. If
+	// zero, the size is not limited.
+	MaxFileSize int64
+}
+
+// Restrict returns a FileSystem that enforces policy on fs. Denied paths are
+// reported as not existing by all operations, including symbolic links
+// resolving to them, so they can't be discovered. Symbolic links are only
+// resolved if policy denies paths; the absolute links of OS are resolved
+// relative to its root, and denied if they point outside of it. The returned
+// FileSystem never implements WriteFileSystem, even if fs does.
+//
+// Restrict returns path.ErrBadPattern if a pattern of policy is malformed.
+func Restrict(fs FileSystem, policy Policy) (FileSystem, error) {
+	for _, patterns := range [][]string{policy.Deny, policy.Hide} {
+		for _, pattern := range patterns {
+			if _, err := Match(pattern, "/"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return restrictedFileSystem{fs, policy}, nil
+}
+
+type restrictedFileSystem struct {
+	fs     FileSystem
+	policy Policy
+}
+
+// errOutside is returned by hostLinks for symbolic links that point outside of
+// the file system.
+var errOutside = errors.New("symbolic link points outside of the file system")
+
+// hostFileSystem is implemented by file systems whose symbolic links are
+// resolved by the host, such as OS.
+type hostFileSystem interface {
+	hostPath(target string) (string, bool)
+}
+
+// hostLinks reads the symbolic links of a hostFileSystem, with the absolute
+// host paths they point to mapped to paths in the file system.
+type hostLinks struct {
+	ReadlinkFileSystem
+	host hostFileSystem
+}
+
+func (fs hostLinks) Readlink(name string) (string, error) {
+	target, err := fs.ReadlinkFileSystem.Readlink(name)
+	if err != nil || !filepath.IsAbs(target) {
+		return filepath.ToSlash(target), err
+	}
+	if target, ok := fs.host.hostPath(target); ok {
+		return target, nil
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: errOutside}
+}
+
+// evalSymlinks returns name with its symbolic links resolved the way fs
+// resolves them. Links pointing outside of the file system fail with
+// errOutside.
+func (fs restrictedFileSystem) evalSymlinks(name string) (string, error) {
+	rfs, ok := fs.fs.(ReadlinkFileSystem)
+	if !ok {
+		return name, nil
+	}
+	if host, ok := fs.fs.(hostFileSystem); ok {
+		rfs = hostLinks{rfs, host}
+	}
+	return EvalSymlinks(rfs, name)
+}
+
+// matchAny reports whether name or one of its parent directories matches one
+// of patterns.
+func matchAny(patterns []string, name string) bool {
+	for name = path.Clean("/" + name); ; name = path.Dir(name) {
+		for _, pattern := range patterns {
+			if ok, _ := Match(pattern, name); ok {
+				return true
+			}
+		}
+		if name == "/" {
+			return false
+		}
+	}
+}
+
+// matchHide reports whether name itself matches one of patterns. Unlike
+// denied paths, the contents of hidden directories are listed.
+func matchHide(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns a not exist error if name is denied. If follow is set, the
+// destination of symbolic links in name must not be denied either.
+func (fs restrictedFileSystem) check(op, name string, follow bool) error {
+	if len(fs.policy.Deny) == 0 {
+		return nil
+	}
+	if matchAny(fs.policy.Deny, name) {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+
+	// Resolve the links in the parents of name, and name itself if it is
+	// followed. Links outside of the file system are denied, other errors
+	// are left to the operation itself.
+	name = path.Clean("/" + name)
+	var (
+		dest string
+		err  error
+	)
+	if follow {
+		dest, err = fs.evalSymlinks(name)
+	} else if dest, err = fs.evalSymlinks(path.Dir(name)); err == nil {
+		dest = path.Join(dest, path.Base(name))
+	}
+	if errors.Is(err, errOutside) || err == nil && matchAny(fs.policy.Deny, dest) {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+// info returns info with the mode masked by the policy.
+func (fs restrictedFileSystem) info(info os.FileInfo) os.FileInfo {
+	if fs.policy.ModeMask == 0 {
+		return info
+	}
+	if _, ok := info.(HardLinkInfo); ok {
+		return restrictedLinkInfo{restrictedInfo{info, fs.policy.ModeMask}}
+	}
+	return restrictedInfo{info, fs.policy.ModeMask}
+}
+
+func (fs restrictedFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs restrictedFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	if err := fs.check("open", name, true); err != nil {
+		return nil, err
+	}
+	if fs.policy.MaxFileSize > 0 {
+		info, err := StatContext(ctx, fs.fs, name)
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() > fs.policy.MaxFileSize {
+			return nil, &os.PathError{Op: "open", Path: name, Err: ErrTooLarge}
+		}
+	}
+	return OpenContext(ctx, fs.fs, name)
+}
+
+func (fs restrictedFileSystem) Lstat(name string) (os.FileInfo, error) {
+	if err := fs.check("lstat", name, false); err != nil {
+		return nil, err
+	}
+	info, err := fs.fs.Lstat(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.info(info), nil
+}
+
+func (fs restrictedFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.StatContext(context.Background(), name)
+}
+
+func (fs restrictedFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	if err := fs.check("stat", name, true); err != nil {
+		return nil, err
+	}
+	info, err := StatContext(ctx, fs.fs, name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.info(info), nil
+}
+
+func (fs restrictedFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs restrictedFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	if err := fs.check("readdir", name, true); err != nil {
+		return nil, err
+	}
+	infos, err := ReaddirContext(ctx, fs.fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The directory itself is allowed, so are its entries unless they
+	// match themselves, by name or by their path with links resolved.
+	dir := path.Clean("/" + name)
+	dest := dir
+	if len(fs.policy.Deny) > 0 {
+		if d, err := fs.evalSymlinks(dir); err == nil {
+			dest = d
+		}
+	}
+	allowed := infos[:0:0]
+	for _, info := range infos {
+		child := path.Join(dir, info.Name())
+		if matchHide(fs.policy.Hide, child) || matchAny(fs.policy.Deny, child) ||
+			matchAny(fs.policy.Deny, path.Join(dest, info.Name())) {
+			continue
+		}
+		allowed = append(allowed, fs.info(info))
+	}
+	return allowed, nil
+}
+
+func (fs restrictedFileSystem) Readlink(name string) (string, error) {
+	if err := fs.check("readlink", name, false); err != nil {
+		return "", err
+	}
+	return Readlink(fs.fs, name)
+}
+
+func (fs restrictedFileSystem) String() string {
+	return fs.fs.String()
+}
+
+// restrictedInfo is an os.FileInfo with masked permission bits.
+type restrictedInfo struct {
+	os.FileInfo
+	mask os.FileMode
+}
+
+func (info restrictedInfo) Mode() os.FileMode {
+	mode := info.FileInfo.Mode()
+	return mode&^os.ModePerm | mode&info.mask&os.ModePerm
+}
+
+func (info restrictedInfo) Metadata() Metadata {
+	return MetadataOf(info.FileInfo)
+}
+
+// restrictedLinkInfo is a restrictedInfo of a hard link.
+type restrictedLinkInfo struct {
+	restrictedInfo
+}
+
+func (info restrictedLinkInfo) HardLink() string {
+	return info.FileInfo.(HardLinkInfo).HardLink()
+}
+
+var (
+	_ ContextFileSystem  = restrictedFileSystem{}
+	_ ReadlinkFileSystem = restrictedFileSystem{}
+	_ MetadataInfo       = restrictedInfo{}
+	_ HardLinkInfo       = restrictedLinkInfo{}
+	_ MetadataInfo       = restrictedLinkInfo{}
+)
@@ -0,0 +1,185 @@
+package vfs_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+	"textmodes.com/vfs/tarfs"
+)
+
+func TestRestrict(t *testing.T) {
+	fs, err := vfs.Restrict(mapfs.New(map[string]string{
+		"a":                "a",
+		"big":              "too large",
+		"private/key":      "secret",
+		"src/.git/HEAD":    "ref",
+		"src/main.go":      "package main",
+		"src/.hidden/file": "file",
+	}), vfs.Policy{
+		Deny:        []string{"/private", "**/.git"},
+		Hide:        []string{"**/.hidden"},
+		ModeMask:    0555,
+		MaxFileSize: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"/private", "/private/key", "/src/.git/HEAD"} {
+		if _, err := fs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("Stat(%q): expected a not exist error, got %v", name, err)
+		}
+		if _, err := fs.Open(name); !os.IsNotExist(err) {
+			t.Errorf("Open(%q): expected a not exist error, got %v", name, err)
+		}
+	}
+	if _, err := fs.Readdir("/private"); !os.IsNotExist(err) {
+		t.Errorf("Readdir: expected a not exist error, got %v", err)
+	}
+
+	for dir, want := range map[string][]string{"/": {"a", "big", "src"}, "/src": {"main.go"}} {
+		infos, err := fs.Readdir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		if len(names) != len(want) {
+			t.Errorf("Readdir(%q): expected %q, got %q", dir, want, names)
+			continue
+		}
+		for i := range want {
+			if names[i] != want[i] {
+				t.Errorf("Readdir(%q): expected %q, got %q", dir, want, names)
+				break
+			}
+		}
+	}
+
+	if _, err := fs.Stat("/src/.hidden/file"); err != nil {
+		t.Errorf("expected hidden files to be accessible by name, got %v", err)
+	}
+	if infos, err := fs.Readdir("/src/.hidden"); err != nil {
+		t.Error(err)
+	} else if len(infos) != 1 || infos[0].Name() != "file" {
+		t.Errorf("expected the contents of hidden directories to be listed, got %d entries", len(infos))
+	}
+
+	info, err := fs.Stat("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := os.FileMode(0444); info.Mode() != want {
+		t.Errorf("expected mode %v, got %v", want, info.Mode())
+	}
+	if _, ok := info.(vfs.HardLinkInfo); ok {
+		t.Errorf("expected a regular file not to be a vfs.HardLinkInfo")
+	}
+
+	if _, err := fs.Open("/big"); !errors.Is(err, vfs.ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+	if _, ok := fs.(vfs.WriteFileSystem); ok {
+		t.Error("expected a read-only file system")
+	}
+
+	if _, err := vfs.Restrict(mapfs.New(nil), vfs.Policy{Deny: []string{"["}}); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
+
+func TestRestrictSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.Mkdir(filepath.Join(dir, "private"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "private", "key"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Mkdir(filepath.Join(dir, "pub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "pub", "file"), []byte("public"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink("private", filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+	for name, target := range map[string]string{
+		"abs":     filepath.Join(dir, "private"),
+		"abspub":  filepath.Join(dir, "pub"),
+		"outside": filepath.Dir(dir),
+	} {
+		if err = os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := vfs.Restrict(vfs.OS(dir), vfs.Policy{Deny: []string{"/private"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Open("/link/key"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if _, err := fs.Readdir("/link"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+
+	// Absolute links are resolved relative to the root.
+	for _, name := range []string{"/abs/key", "/outside", "/outside/" + filepath.Base(dir) + "/pub/file"} {
+		if _, err := fs.Open(name); !os.IsNotExist(err) {
+			t.Errorf("Open(%q): expected a not exist error, got %v", name, err)
+		}
+	}
+	if _, err := fs.Readdir("/abs"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if _, err := fs.Lstat("/outside"); err != nil {
+		t.Errorf("expected Lstat of links outside of the root to succeed, got %v", err)
+	}
+	f, err := fs.Open("/abspub/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func TestRestrictHardLink(t *testing.T) {
+	var r recorder
+	archive, err := tarfs.Open("testdata/tar/test_leading_slash.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := vfs.Restrict(vfs.Traced(archive, &r), vfs.Policy{ModeMask: 0555})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fs.Stat("/foo/hardlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link, ok := info.(vfs.HardLinkInfo); !ok {
+		t.Errorf("expected a vfs.HardLinkInfo, got %T", info)
+	} else if want := "/foo/file"; link.HardLink() != want {
+		t.Errorf("expected link to %q, got %q", want, link.HardLink())
+	}
+
+	// Without denied paths, links don't have to be resolved.
+	if len(r) != 1 {
+		t.Errorf("expected only the Stat to reach the file system, got %q", r)
+	}
+}
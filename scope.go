@@ -1,9 +1,11 @@
 package vfs
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
+	"reflect"
 	"sort"
 	"strings"
 	"time"
@@ -13,6 +15,8 @@ type fileSystem struct {
 	root string
 	base string
 	fs   FileSystem
+	opts BindOptions
+	lazy bool // bound with BindFunc
 }
 
 // translate translates path for use in m, replacing old with new.
@@ -28,6 +32,11 @@ func (fs fileSystem) translate(name string) string {
 
 // Scope is a scoped file system. The file system always has at lease one
 // entry; the root at / always exists and is a directory.
+//
+// Scope implements WriteFileSystem by writing to the first mount for a path
+// that supports writes. Since a Scope always passes a WriteFileSystem type
+// assertion, its write methods return ErrNotSupported if there is no such
+// mount.
 type Scope map[string][]fileSystem
 
 // NewScope sets up a scope with / mounted.
@@ -54,20 +63,65 @@ const (
 	BindAfter
 )
 
+// UnionPolicy determines how the directory listings of a bind are merged
+// with those of the binds consulted before it.
+type UnionPolicy int
+
+// Union policies.
+const (
+	// UnionMerge adds the entries the binds before don't have.
+	UnionMerge UnionPolicy = iota
+
+	// UnionFirst adds the entries the binds before don't have, and stops
+	// the merge if the directory exists in the bind, so the binds after
+	// it aren't listed.
+	UnionFirst
+
+	// UnionDirs adds only the directories the binds before don't have.
+	UnionDirs
+)
+
+// BindOptions configure a bind, see BindWith.
+type BindOptions struct {
+	// Union is the policy for merging the directory listings of the bind.
+	Union UnionPolicy
+
+	// Whiteouts enables whiteout markers in the bind, as used by overlay
+	// file systems and container image layers: a file ".wh.name" hides
+	// name from the binds after it, and a file ".wh..wh..opq" hides all of
+	// the contents of its directory in the binds after it. The markers
+	// themselves are hidden.
+	Whiteouts bool
+}
+
+// Whiteout markers.
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
 // Bind causes references to root to redirect to the path base in fs.
 // If mode is BindReplace, root redirections are discarded.
 // If mode is BindBefore, this redirection takes priority over existing ones,
 // but earlier ones are still consulted for paths that do not exist in fs.
 // If mode is BindAfter, this redirection happens only after existing ones
 // have been tried and failed.
+//
+// Directory listings are merged with UnionMerge; use BindWith for other
+// policies.
 func (scope Scope) Bind(root, base string, fs FileSystem, mode BindMode) {
-	root = scope.clean(root)
-	base = scope.clean(base)
+	scope.BindWith(root, base, fs, mode, BindOptions{})
+}
 
-	var (
-		newFS  = fileSystem{root, base, fs}
-		mounts []fileSystem
-	)
+// BindWith is like Bind, with options for the bind.
+func (scope Scope) BindWith(root, base string, fs FileSystem, mode BindMode, opts BindOptions) {
+	scope.bind(fileSystem{root: scope.clean(root), base: scope.clean(base), fs: fs, opts: opts}, mode)
+}
+
+// bind binds newFS at its root.
+func (scope Scope) bind(newFS fileSystem, mode BindMode) {
+	root := newFS.root
+	var mounts []fileSystem
 	switch mode {
 	case BindReplace:
 		mounts = append(mounts, newFS)
@@ -96,6 +150,120 @@ func (scope Scope) Bind(root, base string, fs FileSystem, mode BindMode) {
 	scope[root] = mounts
 }
 
+// BindFunc is like Bind with base /, for the file system returned by open.
+// Open is only called when a lookup first reaches root; concurrent lookups
+// share one call. If open fails, its error is returned by the lookups that
+// reach root until the retry backoff expires, see BindFuncMinRetry. Listing
+// the parent directory of root doesn't call open.
+//
+// BindFunc returns the bound FileSystem, to pass to Unbind or Rebind. Until
+// open is called, its String method returns "lazy(root)".
+func (scope Scope) BindFunc(root string, open func() (FileSystem, error), mode BindMode) FileSystem {
+	return scope.BindFuncContext(root, func(context.Context) (FileSystem, error) {
+		return open()
+	}, mode)
+}
+
+// BindFuncContext is like BindFunc, for a constructor that can be canceled.
+// The context passed to open is canceled once no lookup waits for it
+// anymore; the next lookup calls open again.
+func (scope Scope) BindFuncContext(root string, open func(ctx context.Context) (FileSystem, error), mode BindMode) FileSystem {
+	root = scope.clean(root)
+	fs := &lazyFileSystem{root: root, open: open}
+	scope.bind(fileSystem{root: root, base: "/", fs: fs, lazy: true}, mode)
+	return fs
+}
+
+// Unbind removes the bindings of fs at root, including those inherited by
+// mount points below root from binds made with BindBefore or BindAfter. It
+// reports whether fs was bound at root. If no bindings remain at /, the
+// scope is left with an empty root directory.
+func (scope Scope) Unbind(root string, fs FileSystem) bool {
+	root = scope.clean(root)
+
+	found := false
+	for name, mounts := range scope {
+		var kept []fileSystem
+		for _, m := range mounts {
+			if m.root == root && sameFileSystem(m.fs, fs) {
+				found = true
+				continue
+			}
+			kept = append(kept, m)
+		}
+		switch {
+		case len(kept) == len(mounts):
+		case len(kept) > 0:
+			scope[name] = kept
+		case name == "/":
+			scope[name] = []fileSystem{{root: "/", base: "/", fs: &empty{}}}
+		default:
+			delete(scope, name)
+		}
+	}
+	return found
+}
+
+// Rebind replaces the file system old bound at root with new, keeping the base
+// and the order of the bindings. It reports whether old was bound at root.
+func (scope Scope) Rebind(root string, old, new FileSystem) bool {
+	root = scope.clean(root)
+
+	found := false
+	for _, mounts := range scope {
+		for i, m := range mounts {
+			if m.root == root && sameFileSystem(m.fs, old) {
+				mounts[i].fs = new
+				_, mounts[i].lazy = new.(*lazyFileSystem)
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// Mount describes a binding of a Scope.
+type Mount struct {
+	Root string // path the binding is mounted at
+	Base string // path in the bound file system
+	FS   string // description of the bound file system
+	// Order is the position of the binding at Root, bindings are consulted
+	// from 0 up.
+	Order int
+
+	FileSystem FileSystem  // the bound file system
+	Options    BindOptions // the options of the binding
+	// Inherited is set for bindings copied from a parent mount point by
+	// binding with BindBefore or BindAfter.
+	Inherited bool
+}
+
+// Mounts returns the bindings of the scope, ordered by Root and Order. The
+// bindings a mount point inherits from its parents are included.
+func (scope Scope) Mounts() []Mount {
+	var mounts []Mount
+	for root, ms := range scope {
+		for i, m := range ms {
+			mounts = append(mounts, Mount{
+				Root:       root,
+				Base:       m.translate(root),
+				FS:         m.fs.String(),
+				Order:      i,
+				FileSystem: m.fs,
+				Options:    m.opts,
+				Inherited:  m.root != root,
+			})
+		}
+	}
+	sort.Slice(mounts, func(i, j int) bool {
+		if mounts[i].Root != mounts[j].Root {
+			return mounts[i].Root < mounts[j].Root
+		}
+		return mounts[i].Order < mounts[j].Order
+	})
+	return mounts
+}
+
 func (scope Scope) resolve(name string) []fileSystem {
 	name = scope.clean(name)
 
@@ -110,11 +278,66 @@ func (scope Scope) resolve(name string) []fileSystem {
 	}
 }
 
+// lookup returns the mounts to consult for name: those of resolve, up to the
+// first one hiding name from the mounts after it, and without the mounts
+// where name is a whiteout marker.
+func (scope Scope) lookup(name string) []fileSystem {
+	mounts := scope.resolve(name)
+	marker := strings.HasPrefix(path.Base(name), whiteoutPrefix)
+	var visible []fileSystem
+	for _, m := range mounts {
+		if !m.opts.Whiteouts {
+			visible = append(visible, m)
+			continue
+		}
+		if !marker {
+			visible = append(visible, m)
+		}
+		if m.whiteout(name) {
+			break
+		}
+	}
+	return visible
+}
+
+// whiteout reports whether the mount hides name from the mounts after it,
+// with a whiteout marker for name or one of its parents, or an opaque marker
+// in one of its parents.
+func (fs fileSystem) whiteout(name string) bool {
+	name = path.Clean("/" + name)
+	for p := name; p != fs.root && hasPathPrefix(p, fs.root); p = path.Dir(p) {
+		dir := fs.translate(path.Dir(p))
+		for _, marker := range []string{whiteoutPrefix + path.Base(p), whiteoutOpaque} {
+			if _, err := fs.fs.Lstat(path.Join(dir, marker)); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Locate implements the MountFileSystem Locate method. It returns the first
+// mount containing name.
+func (scope Scope) Locate(name string) (FileSystem, string, bool) {
+	for _, m := range scope.lookup(name) {
+		base := m.translate(name)
+		if _, err := m.fs.Lstat(base); err == nil {
+			return m.fs, base, true
+		}
+	}
+	return nil, "", false
+}
+
 // Open implements the FileSystem Open method.
 func (scope Scope) Open(name string) (ReadSeekCloser, error) {
+	return scope.OpenContext(context.Background(), name)
+}
+
+// OpenContext implements the ContextFileSystem OpenContext method.
+func (scope Scope) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
 	var err error
-	for _, m := range scope.resolve(name) {
-		r, err1 := m.fs.Open(m.translate(name))
+	for _, m := range scope.lookup(name) {
+		r, err1 := OpenContext(ctx, m.fs, m.translate(name))
 		if err1 == nil {
 			return r, nil
 		}
@@ -127,25 +350,25 @@ func (scope Scope) Open(name string) (ReadSeekCloser, error) {
 	if err == nil {
 		err = &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
 	}
-	return nil, err
+	return nil, withPath(err, name)
 }
 
 // stat implements the FileSystem Stat and Lstat methods.
 func (scope Scope) stat(name string, f func(FileSystem, string) (os.FileInfo, error)) (os.FileInfo, error) {
 	var err error
-	for _, mount := range scope.resolve(name) {
+	for _, mount := range scope.lookup(name) {
 		info, err1 := f(mount.fs, mount.translate(name))
 		if err1 == nil {
 			return info, nil
 		}
-		if err == nil {
+		if err == nil || os.IsNotExist(err) {
 			err = err1
 		}
 	}
 	if err == nil {
 		err = &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
 	}
-	return nil, err
+	return nil, withPath(err, name)
 }
 
 // Stat returns a FileInfo describing the named file.
@@ -154,6 +377,14 @@ func (scope Scope) Stat(name string) (os.FileInfo, error) {
 	return scope.stat(name, FileSystem.Stat)
 }
 
+// StatContext implements the ContextFileSystem StatContext method.
+func (scope Scope) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	Tracef(scope, "Stat(%q)", name)
+	return scope.stat(name, func(fs FileSystem, name string) (os.FileInfo, error) {
+		return StatContext(ctx, fs, name)
+	})
+}
+
 // Lstat returns a FileInfo describing the named file. If the file is a
 // symbolic link, the returned FileInfo describes the symbolic link. Lstat
 // makes no attempt to follow the link.
@@ -162,68 +393,85 @@ func (scope Scope) Lstat(name string) (os.FileInfo, error) {
 	return scope.stat(name, FileSystem.Lstat)
 }
 
+// Readlink returns the destination of the named symbolic link, from the first
+// mount that supports symbolic links and contains name. The destination is
+// returned as stored, relative to that mount.
+func (scope Scope) Readlink(name string) (string, error) {
+	Tracef(scope, "Readlink(%q)", name)
+	var err error
+	for _, m := range scope.lookup(name) {
+		fs, ok := m.fs.(ReadlinkFileSystem)
+		if !ok {
+			continue
+		}
+		target, err1 := fs.Readlink(m.translate(name))
+		if err1 == nil {
+			return target, nil
+		}
+		if err == nil {
+			err = err1
+		}
+	}
+	if err == nil {
+		err = &os.PathError{Op: "readlink", Path: name, Err: ErrNotSupported}
+	}
+	return "", withPath(err, name)
+}
+
 // Readdir reads the contents of the directory associated with name.
 func (scope Scope) Readdir(name string) ([]os.FileInfo, error) {
+	return scope.ReaddirContext(context.Background(), name)
+}
+
+// ReaddirContext implements the ContextFileSystem ReaddirContext method.
+func (scope Scope) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
 	name = scope.clean(name)
 	Tracef(scope, "Readdir(%q)", name)
 
 	var (
-		haveGo   = false
 		haveName = map[string]bool{}
+		hidden   = map[string]bool{}
 		all      []os.FileInfo
+		found    bool
 		err      error
-		first    []os.FileInfo
 	)
 
 	for _, m := range scope.resolve(name) {
-		dir, err1 := m.fs.Readdir(m.translate(name))
+		dir, err1 := ReaddirContext(ctx, m.fs, m.translate(name))
 		if err1 != nil {
-			if err == nil {
+			if err == nil || os.IsNotExist(err) {
 				err = err1
 			}
-			continue
-		}
-
-		if dir == nil {
-			dir = []os.FileInfo{}
-		}
-
-		if first == nil {
-			first = dir
-		}
-
-		// If we don't yet have Go files in 'all' and this directory
-		// has some, add all the files from this directory.
-		// Otherwise, only add subdirectories.
-		useFiles := false
-		if !haveGo {
+		} else {
+			found = true
+			opaque := false
+			var hides []string
 			for _, d := range dir {
-				if strings.HasSuffix(d.Name(), ".go") {
-					useFiles = true
-					haveGo = true
-					break
+				name := d.Name()
+				if m.opts.Whiteouts && strings.HasPrefix(name, whiteoutPrefix) {
+					if name == whiteoutOpaque {
+						opaque = true
+					} else {
+						hides = append(hides, name[len(whiteoutPrefix):])
+					}
+					continue
+				}
+				if haveName[name] || hidden[name] || (m.opts.Union == UnionDirs && !d.IsDir()) {
+					continue
 				}
-			}
-		}
-
-		for _, d := range dir {
-			name := d.Name()
-			if (d.IsDir() || useFiles) && !haveName[name] {
 				haveName[name] = true
 				all = append(all, d)
 			}
-		}
-	}
-
-	// We didn't find any directories containing Go files.
-	// If some directory returned successfully, use that.
-	if !haveGo {
-		for _, d := range first {
-			if !haveName[d.Name()] {
-				haveName[d.Name()] = true
-				all = append(all, d)
+			for _, name := range hides {
+				hidden[name] = true
+			}
+			if opaque || m.opts.Union == UnionFirst {
+				break
 			}
 		}
+		if m.opts.Whiteouts && m.whiteout(name) {
+			break
+		}
 	}
 
 	// Built union.  Add any missing directories needed to reach mount points.
@@ -238,18 +486,165 @@ func (scope Scope) Readdir(name string) ([]os.FileInfo, error) {
 			if !haveName[elem] {
 				haveName[elem] = true
 				all = append(all, dirInfo(elem))
+			} else if old == path.Join(name, elem) && scope.lazy(old) {
+				// The mount point of BindFunc is a directory, even if
+				// it shadows a file, such as the archive it mounts.
+				for i, d := range all {
+					if d.Name() == elem && !d.IsDir() {
+						all[i] = dirInfo(elem)
+					}
+				}
 			}
 		}
 	}
 
-	if len(all) == 0 {
-		return nil, err
+	if len(all) == 0 && !found {
+		return nil, withPath(err, name)
 	}
 
 	sort.Sort(byName(all))
 	return all, nil
 }
 
+// lazy reports whether a file system bound with BindFunc is mounted at root.
+func (scope Scope) lazy(root string) bool {
+	for _, m := range scope[root] {
+		if m.lazy && m.root == root {
+			return true
+		}
+	}
+	return false
+}
+
+// writable returns the first mount for name that implements WriteFileSystem
+// and, if it is a Scope itself, has a writable mount for name.
+func (scope Scope) writable(name string) (fileSystem, WriteFileSystem, bool) {
+	for _, m := range scope.lookup(name) {
+		if fs, ok := m.fs.(WriteFileSystem); ok && canWrite(fs, m.translate(name)) {
+			return m, fs, true
+		}
+	}
+	return fileSystem{}, nil, false
+}
+
+// canWrite reports whether name can be written to in fs. Scopes can only be
+// written to if they have a writable mount for name.
+func canWrite(fs WriteFileSystem, name string) bool {
+	switch fs := fs.(type) {
+	case Scope:
+		_, _, ok := fs.writable(name)
+		return ok
+	case *SyncScope:
+		_, _, ok := fs.Snapshot().writable(name)
+		return ok
+	default:
+		return true
+	}
+}
+
+// write calls f with the first writable mount for name.
+func (scope Scope) write(op, name string, f func(WriteFileSystem, string) error) error {
+	m, fs, ok := scope.writable(name)
+	if !ok {
+		return &os.PathError{Op: op, Path: scope.clean(name), Err: ErrNotSupported}
+	}
+	return withPath(f(fs, m.translate(name)), name)
+}
+
+// Create creates or truncates the named file on the first writable mount.
+func (scope Scope) Create(name string) (ReadWriteSeekCloser, error) {
+	return scope.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile opens the named file on the first writable mount.
+func (scope Scope) OpenFile(name string, flag int, perm os.FileMode) (ReadWriteSeekCloser, error) {
+	Tracef(scope, "OpenFile(%q, %#x, %s)", name, flag, perm)
+	var f ReadWriteSeekCloser
+	err := scope.write("open", name, func(fs WriteFileSystem, name string) (err error) {
+		f, err = fs.OpenFile(name, flag, perm)
+		return
+	})
+	return f, err
+}
+
+// Mkdir creates a directory on the first writable mount.
+func (scope Scope) Mkdir(name string, perm os.FileMode) error {
+	Tracef(scope, "Mkdir(%q, %s)", name, perm)
+	return scope.write("mkdir", name, func(fs WriteFileSystem, name string) error {
+		return fs.Mkdir(name, perm)
+	})
+}
+
+// MkdirAll creates a directory and its parents on the first writable mount.
+func (scope Scope) MkdirAll(name string, perm os.FileMode) error {
+	Tracef(scope, "MkdirAll(%q, %s)", name, perm)
+	return scope.write("mkdir", name, func(fs WriteFileSystem, name string) error {
+		return fs.MkdirAll(name, perm)
+	})
+}
+
+// Remove removes a file or empty directory from the first writable mount.
+func (scope Scope) Remove(name string) error {
+	Tracef(scope, "Remove(%q)", name)
+	return scope.write("remove", name, WriteFileSystem.Remove)
+}
+
+// RemoveAll removes a path and its children from the first writable mount.
+func (scope Scope) RemoveAll(name string) error {
+	Tracef(scope, "RemoveAll(%q)", name)
+	return scope.write("removeall", name, WriteFileSystem.RemoveAll)
+}
+
+// Rename renames oldname to newname. Both names must resolve to the same
+// writable file system.
+func (scope Scope) Rename(oldname, newname string) error {
+	Tracef(scope, "Rename(%q, %q)", oldname, newname)
+	oldm, oldfs, ok := scope.writable(oldname)
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrNotSupported}
+	}
+	newm, _, ok := scope.writable(newname)
+	if !ok || !sameFileSystem(oldm.fs, newm.fs) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: ErrNotSupported}
+	}
+	err := oldfs.Rename(oldm.translate(oldname), newm.translate(newname))
+	if err, ok := err.(*os.LinkError); ok {
+		return &os.LinkError{Op: err.Op, Old: oldname, New: newname, Err: err.Err}
+	}
+	return err
+}
+
+// Chmod changes the mode of the named file on the first writable mount.
+func (scope Scope) Chmod(name string, mode os.FileMode) error {
+	Tracef(scope, "Chmod(%q, %s)", name, mode)
+	return scope.write("chmod", name, func(fs WriteFileSystem, name string) error {
+		return fs.Chmod(name, mode)
+	})
+}
+
+// Chtimes changes the access and modification times of the named file on
+// the first writable mount.
+func (scope Scope) Chtimes(name string, atime, mtime time.Time) error {
+	Tracef(scope, "Chtimes(%q, %s, %s)", name, atime, mtime)
+	return scope.write("chtimes", name, func(fs WriteFileSystem, name string) error {
+		return fs.Chtimes(name, atime, mtime)
+	})
+}
+
+// sameFileSystem reports whether a and b are the same FileSystem. File
+// systems of map types are the same if they share the map, other
+// uncomparable types are never considered the same.
+func sameFileSystem(a, b FileSystem) bool {
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) {
+		return false
+	}
+	if t.Kind() == reflect.Map {
+		return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+	}
+	return t.Comparable() && a == b
+}
+
 // dirInfo is a trivial implementation of os.FileInfo for a directory.
 type dirInfo string
 
@@ -280,3 +675,10 @@ func (scope Scope) clean(name string) string {
 func hasPathPrefix(x, y string) bool {
 	return x == y || strings.HasPrefix(x, y) && (strings.HasSuffix(y, "/") || strings.HasPrefix(x[len(y):], "/"))
 }
+
+var (
+	_ ContextFileSystem  = Scope{}
+	_ MountFileSystem    = Scope{}
+	_ ReadlinkFileSystem = Scope{}
+	_ WriteFileSystem    = Scope{}
+)
@@ -1,11 +1,17 @@
 package vfs_test
 
 import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/textmodes/vfs"
-	"github.com/textmodes/vfs/mapfs"
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
 )
 
 func TestNewScope(t *testing.T) {
@@ -52,3 +58,256 @@ func TestNewScope(t *testing.T) {
 		t.Errorf("t2.Modime() : want:%v got:%v", time.Time{}, fi.ModTime())
 	}
 }
+
+func TestScopeUnbind(t *testing.T) {
+	a := mapfs.New(map[string]string{"a": "a"})
+	b := mapfs.New(map[string]string{"b": "b"})
+	c := mapfs.New(map[string]string{"c": "c"})
+
+	scope := vfs.NewScope()
+	scope.Bind("/data", "/", a, vfs.BindReplace)
+	scope.Bind("/data", "/", b, vfs.BindAfter)
+	scope.Bind("/data/sub", "/", c, vfs.BindBefore)
+
+	want := []vfs.Mount{
+		{Root: "/", Base: "/", FS: "empty(/)", Order: 0},
+		{Root: "/data", Base: "/", FS: "mapfs", Order: 0},
+		{Root: "/data", Base: "/", FS: "mapfs", Order: 1},
+		{Root: "/data/sub", Base: "/", FS: "mapfs", Order: 0},
+		{Root: "/data/sub", Base: "/sub", FS: "mapfs", Order: 1},
+		{Root: "/data/sub", Base: "/sub", FS: "mapfs", Order: 2},
+	}
+	got := scope.Mounts()
+	for i := range got {
+		if inherited := got[i].Root == "/data/sub" && got[i].Order > 0; got[i].Inherited != inherited {
+			t.Errorf("%s %d: expected inherited %t", got[i].Root, got[i].Order, inherited)
+		}
+		got[i].FileSystem, got[i].Inherited = nil, false
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected mounts %v, got %v", want, got)
+	}
+
+	if !scope.Unbind("/data", a) {
+		t.Fatal("expected a to be bound at /data")
+	}
+	if scope.Unbind("/data", a) {
+		t.Error("expected a to be unbound")
+	}
+	if _, err := scope.Stat("/data/a"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if _, err := scope.Stat("/data/b"); err != nil {
+		t.Error(err)
+	}
+	if got := len(scope.Mounts()); got != 4 {
+		t.Errorf("expected 4 mounts, got %d: %v", got, scope.Mounts())
+	}
+
+	if !scope.Rebind("/data", b, a) {
+		t.Fatal("expected b to be bound at /data")
+	}
+	if _, err := scope.Stat("/data/a"); err != nil {
+		t.Error(err)
+	}
+	if _, err := scope.Stat("/data/b"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+
+	scope.Unbind("/data/sub", c)
+	scope.Unbind("/data", a)
+	if got := scope.Mounts(); len(got) != 1 {
+		t.Errorf("expected only / to be mounted, got %v", got)
+	}
+}
+
+func TestScopeUnion(t *testing.T) {
+	upper := mapfs.New(map[string]string{"dir/a": "upper", "dir/sub/x": "x"})
+	lower := mapfs.New(map[string]string{"dir/a": "lower", "dir/b": "b", "dir/sub2/y": "y"})
+
+	for _, test := range []struct {
+		upper, lower vfs.UnionPolicy
+		want         []string
+	}{
+		{vfs.UnionMerge, vfs.UnionMerge, []string{"a", "b", "sub", "sub2"}},
+		{vfs.UnionFirst, vfs.UnionMerge, []string{"a", "sub"}},
+		{vfs.UnionMerge, vfs.UnionDirs, []string{"a", "sub", "sub2"}},
+	} {
+		scope := vfs.NewScope()
+		scope.BindWith("/", "/", upper, vfs.BindReplace, vfs.BindOptions{Union: test.upper})
+		scope.BindWith("/", "/", lower, vfs.BindAfter, vfs.BindOptions{Union: test.lower})
+		if got := readdirNames(t, scope, "/dir"); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("union %d, %d: expected %q, got %q", test.upper, test.lower, test.want, got)
+		}
+	}
+}
+
+func TestScopeWhiteouts(t *testing.T) {
+	upper := mapfs.New(map[string]string{
+		"dir/a":               "upper",
+		"dir/.wh.b":           "",
+		"dir/.wh.sub":         "",
+		"opaque/.wh..wh..opq": "",
+		"opaque/c":            "upper",
+	})
+	lower := mapfs.New(map[string]string{
+		"dir/a":     "lower",
+		"dir/b":     "b",
+		"dir/c":     "c",
+		"dir/sub/x": "x",
+		"opaque/d":  "d",
+	})
+	scope := vfs.NewScope()
+	scope.BindWith("/", "/", upper, vfs.BindReplace, vfs.BindOptions{Whiteouts: true})
+	scope.Bind("/", "/", lower, vfs.BindAfter)
+
+	if got, want := readdirNames(t, scope, "/dir"), []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, want := readdirNames(t, scope, "/opaque"), []string{"c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	for _, name := range []string{"/dir/b", "/dir/sub", "/dir/sub/x", "/dir/.wh.b", "/opaque/d"} {
+		if _, err := scope.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("Stat(%q): expected a not exist error, got %v", name, err)
+		}
+	}
+	if _, err := scope.Open("/dir/c"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScopeBindFunc(t *testing.T) {
+	defer func(min, max time.Duration) {
+		vfs.BindFuncMinRetry, vfs.BindFuncMaxRetry = min, max
+	}(vfs.BindFuncMinRetry, vfs.BindFuncMaxRetry)
+	vfs.BindFuncMinRetry, vfs.BindFuncMaxRetry = 100*time.Millisecond, time.Second
+
+	var (
+		calls   int32
+		release = make(chan struct{})
+		fail    = errors.New("not yet")
+	)
+	open := func() (vfs.FileSystem, error) {
+		n := atomic.AddInt32(&calls, 1)
+		<-release
+		if n == 1 {
+			return nil, fail
+		}
+		return mapfs.New(map[string]string{"inner": "data"}), nil
+	}
+
+	scope := vfs.NewScope()
+	scope.Bind("/", "/", mapfs.New(map[string]string{"a.zip": "zip"}), vfs.BindReplace)
+	lazy := scope.BindFunc("/a.zip", open, vfs.BindReplace)
+	if s := lazy.String(); s != "lazy(/a.zip)" {
+		t.Errorf("expected lazy(/a.zip), got %s", s)
+	}
+
+	infos, err := scope.Readdir("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "a.zip" || !infos[0].IsDir() {
+		t.Errorf("expected directory a.zip, got %v", infos)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("expected no calls after Readdir, got %d", n)
+	}
+
+	// Concurrent first accesses share the failing call.
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := scope.Stat("/a.zip/inner")
+			errs <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != fail {
+			t.Errorf("expected %v, got %v", fail, err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected 1 call, got %d", n)
+	}
+
+	// The failure is cached until the backoff expires.
+	if _, err = scope.Stat("/a.zip/inner"); err != fail {
+		t.Errorf("expected %v, got %v", fail, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected 1 call, got %d", n)
+	}
+	time.Sleep(vfs.BindFuncMinRetry)
+	if _, err = scope.Stat("/a.zip/inner"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = scope.Open("/a.zip/inner"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected 2 calls, got %d", n)
+	}
+
+	if !scope.Unbind("/a.zip", lazy) {
+		t.Error("expected the file system returned by BindFunc to be unbound")
+	}
+}
+
+func TestScopeBindFuncContext(t *testing.T) {
+	var (
+		calls    int32
+		canceled = make(chan struct{})
+	)
+	open := func(ctx context.Context) (vfs.FileSystem, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// Hang until nobody waits anymore.
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		}
+		return mapfs.New(map[string]string{"inner": "data"}), nil
+	}
+
+	scope := vfs.NewScope()
+	scope.BindFuncContext("/a", open, vfs.BindReplace)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := scope.StatContext(ctx, "/a/inner"); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the constructor to be canceled")
+	}
+
+	// Canceled calls aren't cached as failures.
+	if _, err := scope.Stat("/a/inner"); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expected 2 calls, got %d", n)
+	}
+}
+
+func readdirNames(t *testing.T, fs vfs.FileSystem, name string) []string {
+	infos, err := fs.Readdir(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	return names
+}
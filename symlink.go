@@ -0,0 +1,62 @@
+package vfs
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// Readlink returns the destination of the named symbolic link in fs. If fs is
+// not a ReadlinkFileSystem, an error wrapping ErrNotSupported is returned.
+func Readlink(fs FileSystem, name string) (string, error) {
+	if rfs, ok := fs.(ReadlinkFileSystem); ok {
+		return rfs.Readlink(name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNotSupported}
+}
+
+// EvalSymlinks returns the path name after the evaluation of any symbolic
+// links in fs. Link destinations are interpreted relative to the root of fs,
+// and can't point outside of it.
+func EvalSymlinks(fs ReadlinkFileSystem, name string) (string, error) {
+	var (
+		dest  = "/"
+		elems = strings.Split(name, "/")
+		links int
+	)
+	for len(elems) > 0 {
+		elem := elems[0]
+		elems = elems[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			dest = path.Dir(dest)
+			continue
+		}
+
+		next := path.Join(dest, elem)
+		info, err := fs.Lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			dest = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", &os.PathError{Op: "lstat", Path: name, Err: ErrSymlinkLoop}
+		}
+		target, err := fs.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			dest = "/"
+		}
+		elems = append(strings.Split(target, "/"), elems...)
+	}
+	return dest, nil
+}
@@ -0,0 +1,197 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncScope is a Scope that is safe for concurrent use. Operations read a
+// snapshot of the mount table without locking, binds and other changes copy
+// the table and replace it atomically. The zero value is an empty scope, like
+// Scope{}; use NewSyncScope for a scope with / mounted.
+type SyncScope struct {
+	mu    sync.Mutex // serializes changes
+	scope atomic.Value
+}
+
+// NewSyncScope sets up a concurrency safe scope with / mounted.
+func NewSyncScope() *SyncScope {
+	s := new(SyncScope)
+	s.scope.Store(NewScope())
+	return s
+}
+
+// Snapshot returns the current mount table. It must not be modified.
+func (s *SyncScope) Snapshot() Scope {
+	scope, _ := s.scope.Load().(Scope)
+	return scope
+}
+
+// Update calls f with a copy of the mount table, and replaces the table with
+// the copy when f returns. Concurrent operations see either all or none of
+// the changes made by f.
+func (s *SyncScope) Update(f func(scope Scope)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.Snapshot()
+	scope := make(Scope, len(old))
+	for root, mounts := range old {
+		scope[root] = append([]fileSystem(nil), mounts...)
+	}
+	f(scope)
+	s.scope.Store(scope)
+}
+
+// Bind is like Scope.Bind.
+func (s *SyncScope) Bind(root, base string, fs FileSystem, mode BindMode) {
+	s.BindWith(root, base, fs, mode, BindOptions{})
+}
+
+// BindWith is like Scope.BindWith.
+func (s *SyncScope) BindWith(root, base string, fs FileSystem, mode BindMode, opts BindOptions) {
+	s.Update(func(scope Scope) {
+		scope.BindWith(root, base, fs, mode, opts)
+	})
+}
+
+// BindFunc is like Scope.BindFunc.
+func (s *SyncScope) BindFunc(root string, open func() (FileSystem, error), mode BindMode) (fs FileSystem) {
+	s.Update(func(scope Scope) {
+		fs = scope.BindFunc(root, open, mode)
+	})
+	return fs
+}
+
+// BindFuncContext is like Scope.BindFuncContext.
+func (s *SyncScope) BindFuncContext(root string, open func(ctx context.Context) (FileSystem, error), mode BindMode) (fs FileSystem) {
+	s.Update(func(scope Scope) {
+		fs = scope.BindFuncContext(root, open, mode)
+	})
+	return fs
+}
+
+// Unbind is like Scope.Unbind.
+func (s *SyncScope) Unbind(root string, fs FileSystem) (found bool) {
+	s.Update(func(scope Scope) {
+		found = scope.Unbind(root, fs)
+	})
+	return found
+}
+
+// Rebind is like Scope.Rebind.
+func (s *SyncScope) Rebind(root string, old, new FileSystem) (found bool) {
+	s.Update(func(scope Scope) {
+		found = scope.Rebind(root, old, new)
+	})
+	return found
+}
+
+// Mounts is like Scope.Mounts.
+func (s *SyncScope) Mounts() []Mount {
+	return s.Snapshot().Mounts()
+}
+
+// Open implements the FileSystem Open method.
+func (s *SyncScope) Open(name string) (ReadSeekCloser, error) {
+	return s.Snapshot().Open(name)
+}
+
+// OpenContext implements the ContextFileSystem OpenContext method.
+func (s *SyncScope) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	return s.Snapshot().OpenContext(ctx, name)
+}
+
+// Stat implements the FileSystem Stat method.
+func (s *SyncScope) Stat(name string) (os.FileInfo, error) {
+	return s.Snapshot().Stat(name)
+}
+
+// StatContext implements the ContextFileSystem StatContext method.
+func (s *SyncScope) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	return s.Snapshot().StatContext(ctx, name)
+}
+
+// Lstat implements the FileSystem Lstat method.
+func (s *SyncScope) Lstat(name string) (os.FileInfo, error) {
+	return s.Snapshot().Lstat(name)
+}
+
+// Readlink implements the ReadlinkFileSystem Readlink method.
+func (s *SyncScope) Readlink(name string) (string, error) {
+	return s.Snapshot().Readlink(name)
+}
+
+// Locate implements the MountFileSystem Locate method.
+func (s *SyncScope) Locate(name string) (FileSystem, string, bool) {
+	return s.Snapshot().Locate(name)
+}
+
+// Readdir implements the FileSystem Readdir method.
+func (s *SyncScope) Readdir(name string) ([]os.FileInfo, error) {
+	return s.Snapshot().Readdir(name)
+}
+
+// ReaddirContext implements the ContextFileSystem ReaddirContext method.
+func (s *SyncScope) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	return s.Snapshot().ReaddirContext(ctx, name)
+}
+
+// Create is like Scope.Create.
+func (s *SyncScope) Create(name string) (ReadWriteSeekCloser, error) {
+	return s.Snapshot().Create(name)
+}
+
+// OpenFile is like Scope.OpenFile.
+func (s *SyncScope) OpenFile(name string, flag int, perm os.FileMode) (ReadWriteSeekCloser, error) {
+	return s.Snapshot().OpenFile(name, flag, perm)
+}
+
+// Mkdir is like Scope.Mkdir.
+func (s *SyncScope) Mkdir(name string, perm os.FileMode) error {
+	return s.Snapshot().Mkdir(name, perm)
+}
+
+// MkdirAll is like Scope.MkdirAll.
+func (s *SyncScope) MkdirAll(name string, perm os.FileMode) error {
+	return s.Snapshot().MkdirAll(name, perm)
+}
+
+// Remove is like Scope.Remove.
+func (s *SyncScope) Remove(name string) error {
+	return s.Snapshot().Remove(name)
+}
+
+// RemoveAll is like Scope.RemoveAll.
+func (s *SyncScope) RemoveAll(name string) error {
+	return s.Snapshot().RemoveAll(name)
+}
+
+// Rename is like Scope.Rename.
+func (s *SyncScope) Rename(oldname, newname string) error {
+	return s.Snapshot().Rename(oldname, newname)
+}
+
+// Chmod is like Scope.Chmod.
+func (s *SyncScope) Chmod(name string, mode os.FileMode) error {
+	return s.Snapshot().Chmod(name, mode)
+}
+
+// Chtimes is like Scope.Chtimes.
+func (s *SyncScope) Chtimes(name string, atime, mtime time.Time) error {
+	return s.Snapshot().Chtimes(name, atime, mtime)
+}
+
+func (s *SyncScope) String() string {
+	return s.Snapshot().String()
+}
+
+var (
+	_ ContextFileSystem  = (*SyncScope)(nil)
+	_ ReadlinkFileSystem = (*SyncScope)(nil)
+	_ MountFileSystem    = (*SyncScope)(nil)
+	_ WriteFileSystem    = (*SyncScope)(nil)
+)
@@ -0,0 +1,114 @@
+package vfs_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/autofs"
+	"textmodes.com/vfs/mapfs"
+)
+
+// TestSyncScopeRace binds and unbinds file systems while other goroutines use
+// the scope; run it with the race detector.
+func TestSyncScopeRace(t *testing.T) {
+	scope := vfs.NewSyncScope()
+	stable := mapfs.New(map[string]string{"stable/file": "stable"})
+	scope.Bind("/", "/", stable, vfs.BindAfter)
+
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				f, err := scope.Open("/stable/file")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				b, err := ioutil.ReadAll(f)
+				f.Close()
+				if err != nil || string(b) != "stable" {
+					t.Errorf("expected %q, got %q, %v", "stable", b, err)
+					return
+				}
+				if _, err := scope.Readdir("/"); err != nil {
+					t.Error(err)
+					return
+				}
+				scope.Stat("/hot/file")
+				scope.Mounts()
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		fs := mapfs.New(map[string]string{"file": fmt.Sprint(i)})
+		next := mapfs.New(map[string]string{"file": fmt.Sprint(i + 1)})
+		scope.Bind("/hot", "/", fs, vfs.BindBefore)
+		scope.Rebind("/hot", fs, next)
+		if !scope.Unbind("/hot", next) {
+			t.Fatalf("expected /hot to be bound")
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestSyncScopeUpdate(t *testing.T) {
+	scope := vfs.NewSyncScope()
+	a := mapfs.New(map[string]string{"a": "a"})
+	b := mapfs.New(map[string]string{"b": "b"})
+	scope.Bind("/data", "/", a, vfs.BindReplace)
+
+	snapshot := scope.Snapshot()
+	scope.Update(func(s vfs.Scope) {
+		s.Unbind("/data", a)
+		s.Bind("/data", "/", b, vfs.BindReplace)
+	})
+
+	if _, err := scope.Stat("/data/b"); err != nil {
+		t.Error(err)
+	}
+	if _, err := scope.Stat("/data/a"); !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+	if _, err := snapshot.Stat("/data/a"); err != nil {
+		t.Errorf("expected the snapshot to be unchanged, got %v", err)
+	}
+}
+
+// TestAutofsRace mounts archives from several goroutines; run it with the
+// race detector.
+func TestAutofsRace(t *testing.T) {
+	fs, err := autofs.New("testdata/zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bind := fs.(interface {
+		Bind(root, base string, fs vfs.FileSystem, mode vfs.BindMode)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vfs.Walk(fs, "/", func(string, os.FileInfo, error) error { return nil })
+			bind.Bind(fmt.Sprintf("/extra%d", i), "/", mapfs.New(nil), vfs.BindReplace)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -4,12 +4,15 @@ import (
 	"archive/tar"
 	"os"
 	"time"
+
+	"textmodes.com/vfs"
 )
 
 // fileInfo is the zip-file based implementation of FileInfo
 type fileInfo struct {
-	name string      // directory-local name
-	file *tar.Header // nil for a directory
+	name    string      // directory-local name
+	file    *tar.Header // nil for a directory
+	archive string      // name of the containing archive
 }
 
 func (fi fileInfo) Name() string {
@@ -47,3 +50,32 @@ func (fi fileInfo) IsDir() bool {
 func (fi fileInfo) Sys() interface{} {
 	return fi.file
 }
+
+func (fi fileInfo) Metadata() vfs.Metadata {
+	md := vfs.Metadata{
+		Uid:     -1,
+		Gid:     -1,
+		Archive: fi.archive,
+	}
+	if f := fi.file; f != nil {
+		md.Uid, md.Gid = f.Uid, f.Gid
+		md.Uname, md.Gname = f.Uname, f.Gname
+		md.AccessTime, md.ChangeTime = f.AccessTime, f.ChangeTime
+	}
+	return md
+}
+
+// linkInfo is the FileInfo of a hard link, which reports the size of the
+// entry it links to.
+type linkInfo struct {
+	fileInfo
+	target *tar.Header
+}
+
+func (fi linkInfo) Size() int64 {
+	return fi.target.Size
+}
+
+func (fi linkInfo) HardLink() string {
+	return "/" + clean(fi.target.Name)
+}
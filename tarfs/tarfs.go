@@ -2,13 +2,16 @@ package tarfs
 
 import (
 	"archive/tar"
+	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
 	"path"
 	"sort"
 	"strings"
+	"sync"
 
 	"textmodes.com/vfs"
 )
@@ -40,12 +43,52 @@ func (rsc emulatedFile) ReadAt(p []byte, off int64) (n int, err error) {
 	if _, err = rsc.Seek(off, io.SeekStart); err != nil {
 		return
 	}
-	return rsc.Read(p)
+	// Unlike Read, ReadAt must not return short reads without an error.
+	if n, err = io.ReadFull(rsc, p); err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return
+}
+
+// trackedFile is a fileLike registered with vfs.TrackHandle.
+type trackedFile struct {
+	fileLike
+	closed func()
+}
+
+func (f trackedFile) Close() error {
+	f.closed()
+	return f.fileLike.Close()
+}
+
+// contextFile is a fileLike that fails all reads once ctx is done.
+type contextFile struct {
+	fileLike
+	ctx context.Context
+}
+
+func (f contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.fileLike.Read(p)
+}
+
+func (f contextFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.fileLike.ReadAt(p, off)
 }
 
 // Open a name file on disk as FileSystem.
 func Open(name string) (vfs.FileSystem, error) {
-	return open(name, func() (fileLike, error) {
+	return OpenContext(context.Background(), name)
+}
+
+// OpenContext is like Open, but stops reading the archive when ctx is done.
+func OpenContext(ctx context.Context, name string) (vfs.FileSystem, error) {
+	return open(ctx, name, func(context.Context) (fileLike, error) {
 		vfs.Tracef(nil, "os.Open(%q)", name)
 		return os.Open(name)
 	})
@@ -53,14 +96,20 @@ func Open(name string) (vfs.FileSystem, error) {
 
 // OpenFile opens a file on a FileSystem as FileSystem.
 func OpenFile(fs vfs.FileSystem, name string) (vfs.FileSystem, error) {
+	return OpenFileContext(context.Background(), fs, name)
+}
+
+// OpenFileContext is like OpenFile, but stops reading the archive when ctx is
+// done.
+func OpenFileContext(ctx context.Context, fs vfs.FileSystem, name string) (vfs.FileSystem, error) {
 	vfs.Tracef(fs, "OpenFile(%q)", name)
-	return open(name, func() (fileLike, error) {
+	return open(ctx, name, func(ctx context.Context) (fileLike, error) {
 		vfs.Tracef(fs, "OpenFile.open(%q)", name)
-		i, err := fs.Stat(name)
+		i, err := vfs.StatContext(ctx, fs, name)
 		if err != nil {
 			return nil, err
 		}
-		f, err := fs.Open(name)
+		f, err := vfs.OpenContext(ctx, fs, name)
 		if err != nil {
 			return nil, err
 		}
@@ -72,8 +121,8 @@ func OpenFile(fs vfs.FileSystem, name string) (vfs.FileSystem, error) {
 	})
 }
 
-func open(name string, open func() (fileLike, error)) (vfs.FileSystem, error) {
-	z, err := openReadCloser(open)
+func open(ctx context.Context, name string, open func(context.Context) (fileLike, error)) (vfs.FileSystem, error) {
+	z, err := openReadCloser(ctx, open)
 	if err != nil {
 		return nil, err
 	}
@@ -88,13 +137,22 @@ func open(name string, open func() (fileLike, error)) (vfs.FileSystem, error) {
 	)
 reading:
 	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
 		if h, err = z.Next(); err != nil {
 			if err == io.EOF {
 				break reading
 			}
-			return nil, err
+			return nil, &os.PathError{Op: "open", Path: name, Err: tarError(err)}
 		}
 		fs.list = append(fs.list, h)
+		if h.Typeflag == tar.TypeSymlink {
+			if fs.links == nil {
+				fs.links = make(map[string]string)
+			}
+			fs.links[clean(h.Name)] = h.Linkname
+		}
 	}
 
 	sort.SliceStable(fs.list, func(i, j int) bool {
@@ -113,11 +171,15 @@ type readCloser struct {
 	io.Closer
 }
 
-func openReadCloser(open func() (fileLike, error)) (*readCloser, error) {
-	f, err := open()
+func openReadCloser(ctx context.Context, open func(context.Context) (fileLike, error)) (*readCloser, error) {
+	f, err := open(ctx)
 	if err != nil {
 		return nil, err
 	}
+	f = trackedFile{f, vfs.TrackHandle(f.Name())}
+	if ctx.Done() != nil {
+		f = contextFile{f, ctx}
+	}
 
 	if _, err = f.Stat(); err != nil {
 		f.Close()
@@ -127,7 +189,7 @@ func openReadCloser(open func() (fileLike, error)) (*readCloser, error) {
 	r, err := maybeDecompress(f)
 	if err != nil {
 		f.Close()
-		return nil, err
+		return nil, &os.PathError{Op: "open", Path: f.Name(), Err: tarError(err)}
 	}
 
 	return &readCloser{
@@ -136,10 +198,24 @@ func openReadCloser(open func() (fileLike, error)) (*readCloser, error) {
 	}, nil
 }
 
+// tarError maps the errors of archive/tar and the decompressors to their vfs
+// equivalent.
+func tarError(err error) error {
+	switch err {
+	case tar.ErrHeader, gzip.ErrHeader, gzip.ErrChecksum, io.ErrUnexpectedEOF:
+		return fmt.Errorf("%w: %v", vfs.ErrCorrupt, err)
+	default:
+		return err
+	}
+}
+
 type fileSystem struct {
-	name string
-	list []*tar.Header
-	open func() (fileLike, error)
+	name   string
+	list   []*tar.Header
+	links  map[string]string
+	open   func(context.Context) (fileLike, error)
+	mu     sync.Mutex // guards tracer
+	tracer vfs.Tracer
 }
 
 func isRoot(abspath string) bool {
@@ -154,42 +230,44 @@ func clean(name string) string {
 // lookup returns the smallest index of an entry with an exact match
 // for name, or an inexact match starting with name/. If there is no
 // such entry, the result is -1, false.
-func (fs fileSystem) lookup(name string) (index int, exact bool) {
+func (fs *fileSystem) lookup(name string) (index int, exact bool) {
+	list := fs.list
 	// look for exact match first (name comes before name/ in z)
-	i := sort.Search(len(fs.list), func(i int) bool {
-		return name <= clean(fs.list[i].Name)
+	i := sort.Search(len(list), func(i int) bool {
+		return name <= clean(list[i].Name)
 	})
-	log.Printf("lookup(%q): %d", name, i)
-	if i >= len(fs.list) {
+	vfs.Tracef(fs, "lookup(%q): %d", name, i)
+	if i >= len(list) {
 		return -1, false
 	}
 	// 0 <= i < len(z)
-	if clean(fs.list[i].Name) == name {
+	if clean(list[i].Name) == name {
 		return i, true
 	}
 
 	// look for inexact match (must be in z[i:], if present)
-	fs.list = fs.list[i:]
+	list = list[i:]
 	name += "/"
-	j := sort.Search(len(fs.list), func(i int) bool {
-		return name <= clean(fs.list[i].Name)
+	j := sort.Search(len(list), func(i int) bool {
+		return name <= clean(list[i].Name)
 	})
-	if j >= len(fs.list) {
+	if j >= len(list) {
 		return -1, false
 	}
 	// 0 <= j < len(z)
-	if strings.HasPrefix(clean(fs.list[i].Name), name) {
+	if strings.HasPrefix(clean(list[j].Name), name) {
 		return i + j, false
 	}
 
 	return -1, false
 }
 
-func (fs *fileSystem) stat(abspath string) (int, fileInfo, error) {
+func (fs *fileSystem) stat(op, abspath string) (int, fileInfo, error) {
 	if isRoot(abspath) {
 		return 0, fileInfo{
-			name: "",
-			file: nil,
+			name:    "",
+			file:    nil,
+			archive: fs.name,
 		}, nil
 	}
 	tarpath := clean(abspath)
@@ -201,7 +279,7 @@ func (fs *fileSystem) stat(abspath string) (int, fileInfo, error) {
 	i, exact := fs.lookup(tarpath)
 	if i < 0 {
 		// rarpath has leading '/' stripped - print it explicitly
-		return -1, fileInfo{}, &os.PathError{Path: "/" + tarpath, Err: os.ErrNotExist}
+		return -1, fileInfo{}, &os.PathError{Op: op, Path: "/" + tarpath, Err: os.ErrNotExist}
 	}
 	_, name := path.Split(tarpath)
 	var file *tar.Header
@@ -209,90 +287,201 @@ func (fs *fileSystem) stat(abspath string) (int, fileInfo, error) {
 		file = fs.list[i] // exact match found - must be a file
 	}
 	name = path.Clean("/" + name)
-	return i, fileInfo{name, file}, nil
+	return i, fileInfo{name, file, fs.name}, nil
+}
+
+// hardlink returns the FileInfo for info, resolving the size of hard links.
+func (fs *fileSystem) hardlink(info fileInfo) os.FileInfo {
+	if info.file == nil || info.file.Typeflag != tar.TypeLink {
+		return info
+	}
+	i, exact := fs.lookup(clean(info.file.Linkname))
+	if !exact {
+		return info // dangling link
+	}
+	return linkInfo{info, fs.list[i]}
 }
 
 func (fs *fileSystem) Lstat(abspath string) (os.FileInfo, error) {
 	vfs.Tracef(fs, "Lstat(%q)", abspath)
-	_, info, err := fs.stat(abspath)
-	return info, err
+	_, info, err := fs.stat("lstat", abspath)
+	if err != nil {
+		return nil, err
+	}
+	return fs.hardlink(info), nil
 }
 
 func (fs *fileSystem) Stat(abspath string) (os.FileInfo, error) {
 	vfs.Tracef(fs, "Stat(%q) -> %q", abspath, clean(abspath))
-	_, info, err := fs.stat(abspath)
-	return info, err
+	target, err := fs.follow(abspath)
+	if err != nil {
+		return nil, err
+	}
+	_, info, err := fs.stat("stat", target)
+	if err != nil {
+		return nil, err
+	}
+	if clean(target) != clean(abspath) {
+		info.name = path.Clean("/" + path.Base(abspath))
+	}
+	return fs.hardlink(info), nil
+}
+
+func (fs *fileSystem) Readlink(abspath string) (string, error) {
+	vfs.Tracef(fs, "Readlink(%q)", abspath)
+	target, ok := fs.links[clean(abspath)]
+	if !ok {
+		if _, _, err := fs.stat("readlink", abspath); err != nil {
+			return "", err
+		}
+		return "", &os.PathError{Op: "readlink", Path: abspath, Err: os.ErrInvalid}
+	}
+	return target, nil
+}
+
+// follow returns abspath with all symbolic links resolved.
+func (fs *fileSystem) follow(abspath string) (string, error) {
+	if len(fs.links) == 0 {
+		return abspath, nil
+	}
+	return vfs.EvalSymlinks(fs, abspath)
 }
 
+// emulatedRSC emulates io.Seeker for a compressed entry by reopening the
+// entry and skipping ahead to the requested offset.
 type emulatedRSC struct {
-	io.Closer
 	io.Reader
-	name string
-	open func() (fileLike, error)
+	io.Closer
+	name   string // full path of the entry, for errors
+	size   int64
+	offset int64
+	open   func() (io.Reader, io.Closer, error)
 }
 
-func (rsc emulatedRSC) Close() error {
-	return rsc.Closer.Close()
+func (rsc *emulatedRSC) Read(p []byte) (n int, err error) {
+	n, err = rsc.Reader.Read(p)
+	rsc.offset += int64(n)
+	return
 }
 
-func (rsc emulatedRSC) Read(p []byte) (n int, err error) {
-	return rsc.Reader.Read(p)
-}
+func (rsc *emulatedRSC) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rsc.offset
+	case io.SeekEnd:
+		offset += rsc.size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: rsc.name, Err: os.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: rsc.name, Err: os.ErrInvalid}
+	}
 
-func (rsc emulatedRSC) Seek(offset int64, whence int) (int64, error) {
-	if whence == 0 && offset == 0 {
-		z, err := rsc.open()
+	if offset < rsc.offset {
+		r, c, err := rsc.open()
 		if err != nil {
 			return 0, err
 		}
 		rsc.Closer.Close()
-		rsc.Closer = z
-		return 0, nil
+		rsc.Reader, rsc.Closer, rsc.offset = r, c, 0
+	}
+	if _, err := io.CopyN(ioutil.Discard, rsc, offset-rsc.offset); err != nil && err != io.EOF {
+		return 0, err
+	}
+	rsc.offset = offset
+	return offset, nil
+}
+
+// openEntry opens the archive and returns a reader for the named entry.
+func (fs *fileSystem) openEntry(ctx context.Context, name string) (io.Reader, io.Closer, error) {
+	z, err := openReadCloser(ctx, fs.open)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		if err = ctx.Err(); err != nil {
+			z.Close()
+			return nil, nil, err
+		}
+		h, err := z.Next()
+		if err == io.EOF {
+			z.Close()
+			return nil, nil, &os.PathError{Op: "open", Path: "/" + clean(name), Err: os.ErrNotExist}
+		} else if err != nil {
+			z.Close()
+			return nil, nil, &os.PathError{Op: "open", Path: "/" + clean(name), Err: tarError(err)}
+		}
+		if clean(h.Name) == clean(name) {
+			return z, z, nil
+		}
 	}
-	return 0, fmt.Errorf("unsupported Seek in %s", rsc.name)
 }
 
 func (fs *fileSystem) Open(abspath string) (vfs.ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), abspath)
+}
+
+func (fs *fileSystem) OpenContext(ctx context.Context, abspath string) (vfs.ReadSeekCloser, error) {
 	vfs.Tracef(fs, "Open(%q)", abspath)
-	_, info, err := fs.stat(abspath)
+	abspath, err := fs.follow(abspath)
+	if err != nil {
+		return nil, err
+	}
+	_, fi, err := fs.stat("open", abspath)
 	if err != nil {
 		return nil, err
 	}
-	if info.IsDir() {
-		return nil, fmt.Errorf("tarfs: %s is a directory", abspath)
+	if fi.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: path.Clean("/" + abspath), Err: vfs.ErrIsDir}
 	}
 
-	z, err := openReadCloser(fs.open)
+	name, info := fi.file.Name, fs.hardlink(fi)
+	if link, ok := info.(linkInfo); ok {
+		name = link.target.Name
+	}
+	r, c, err := fs.openEntry(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	defer z.Close()
+	return &emulatedRSC{
+		Reader: r,
+		Closer: c,
+		name:   path.Clean("/" + abspath),
+		size:   info.Size(),
+		open: func() (io.Reader, io.Closer, error) {
+			return fs.openEntry(ctx, name)
+		},
+	}, nil
+}
 
-	var h *tar.Header
-	for {
-		if h, err = z.Next(); err != nil {
-			return nil, err
-		}
-		if h.Name == info.name {
-			break
-		}
+func (fs *fileSystem) StatContext(ctx context.Context, abspath string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	return emulatedRSC{
-		Reader: z,
-		Closer: z,
-		name:   h.Name,
-		open:   fs.open,
-	}, nil
+	return fs.Stat(abspath)
+}
+
+func (fs *fileSystem) ReaddirContext(ctx context.Context, abspath string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.Readdir(abspath)
 }
 
 func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 	vfs.Tracef(fs, "Readdir(%q)", abspath)
-	i, fi, err := fs.stat(abspath)
+	abspath, err := fs.follow(abspath)
+	if err != nil {
+		return nil, err
+	}
+	i, fi, err := fs.stat("readdir", abspath)
 	if err != nil {
 		return nil, err
 	}
 	if !fi.IsDir() {
-		return nil, fmt.Errorf("rarfs: %s is not a directory", abspath)
+		return nil, &os.PathError{Op: "readdir", Path: path.Clean("/" + abspath), Err: vfs.ErrNotDir}
 	}
 
 	var list []os.FileInfo
@@ -305,16 +494,22 @@ func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 	if isRoot(abspath) {
 		dirname = "/"
 	} else {
-		dirname = clean(abspath) + "/"
+		dirname = "/" + clean(abspath) + "/"
 	}
 	prevname := ""
 	for _, e := range fs.list[i:] {
 		base := path.Clean("/" + e.Name)
 		//vfs.Tracef(fs, "readdir(%q): %q in %q?", abspath, e.Name, dirname)
+		if base+"/" == dirname {
+			continue // the directory itself
+		}
 		if !strings.HasPrefix(base, dirname) {
 			break // not in the same directory anymore
 		}
 		name := base[len(dirname):] // local name
+		if name == "" {
+			continue // the directory itself
+		}
 		file := e
 		if i := strings.IndexRune(name, '/'); i >= 0 {
 			// We infer directories from files in subdirectories.
@@ -327,7 +522,7 @@ func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 		// by determining the (fs.list) range of local directory entries
 		// (via two binary searches).
 		if name != prevname {
-			list = append(list, fileInfo{name, file})
+			list = append(list, fs.hardlink(fileInfo{name, file, fs.name}))
 			prevname = name
 		}
 	}
@@ -335,6 +530,28 @@ func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 	return list, nil
 }
 
+// Tracer returns the Tracer set with SetTracer.
+func (fs *fileSystem) Tracer() vfs.Tracer {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.tracer
+}
+
+// SetTracer sets the Tracer for the operations on the archive.
+func (fs *fileSystem) SetTracer(t vfs.Tracer) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.tracer = t
+}
+
 func (fs *fileSystem) String() string {
 	return fmt.Sprintf(`tarfs(%q)`, fs.name)
 }
+
+var (
+	_ vfs.ContextFileSystem  = (*fileSystem)(nil)
+	_ vfs.HardLinkInfo       = linkInfo{}
+	_ vfs.MetadataInfo       = fileInfo{}
+	_ vfs.ReadlinkFileSystem = (*fileSystem)(nil)
+	_ vfs.TracerFileSystem   = (*fileSystem)(nil)
+)
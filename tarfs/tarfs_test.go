@@ -1,6 +1,11 @@
 package tarfs_test
 
 import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
 	"path"
 	"path/filepath"
 	"testing"
@@ -40,3 +45,167 @@ func testRecursive(t *testing.T, fs vfs.FileSystem, dir string) {
 		}
 	}
 }
+
+func TestOpenContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := tarfs.OpenContext(ctx, "../testdata/tar/test_extract.tar.gz"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	fs, err := tarfs.Open("../testdata/tar/test_extract.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = vfs.ReaddirContext(ctx, fs, "/"); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err = vfs.WithContext(ctx, fs).Stat("/"); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+// writeTar writes a tar archive with the given headers to a temporary file.
+// The contents of regular files are their names.
+func writeTar(t *testing.T, headers []*tar.Header) string {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", "tarfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := tar.NewWriter(f)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(h.Name))
+		}
+		if err = w.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			if _, err = w.Write([]byte(h.Name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestSymlink(t *testing.T) {
+	name := writeTar(t, []*tar.Header{
+		{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "dir/file", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir", Mode: 0777},
+		{Name: "dir/abs", Typeflag: tar.TypeSymlink, Linkname: "/dir/file", Mode: 0777},
+	})
+	defer os.Remove(name)
+
+	fs, err := tarfs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fs.Lstat("/link")
+	if err != nil {
+		t.Fatalf("Lstat: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected Lstat to return a symlink, got mode %s", info.Mode())
+	}
+	if info, err = fs.Stat("/link"); err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if !info.IsDir() {
+		t.Errorf("expected Stat to follow the link to a directory, got mode %s", info.Mode())
+	}
+
+	infos, err := fs.Readdir("/link")
+	if err != nil {
+		t.Fatalf("Readdir: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Errorf("expected 2 entries, got %d", len(infos))
+	}
+
+	f, err := fs.Open("/link/abs")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "dir/file"; string(b) != want {
+		t.Errorf("expected %q, got %q", want, b)
+	}
+}
+
+func TestHardLink(t *testing.T) {
+	fs, err := tarfs.Open("../testdata/tar/test_leading_slash.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fs.Stat("/foo/hardlink")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if want := int64(4); info.Size() != want {
+		t.Errorf("expected size %d, got %d", want, info.Size())
+	}
+	if link, ok := info.(vfs.HardLinkInfo); !ok {
+		t.Errorf("expected a vfs.HardLinkInfo, got %T", info)
+	} else if want := "/foo/file"; link.HardLink() != want {
+		t.Errorf("expected link to %q, got %q", want, link.HardLink())
+	}
+
+	f, err := fs.Open("/foo/hardlink")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 4 {
+		t.Errorf("expected 4 bytes, got %q", b)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	name := writeTar(t, []*tar.Header{
+		{Name: "file", Typeflag: tar.TypeReg, Mode: 0644, Uid: 1000, Gid: 100, Uname: "user", Gname: "users"},
+	})
+	defer os.Remove(name)
+
+	fs, err := tarfs.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := fs.Stat("/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := vfs.MetadataOf(info)
+	if md.Archive != name {
+		t.Errorf("expected archive %q, got %q", name, md.Archive)
+	}
+	if md.Uid != 1000 || md.Gid != 100 {
+		t.Errorf("expected owner 1000:100, got %d:%d", md.Uid, md.Gid)
+	}
+	if md.Uname != "user" || md.Gname != "users" {
+		t.Errorf("expected owner user:users, got %s:%s", md.Uname, md.Gname)
+	}
+	if md.CompressedSize != 0 {
+		t.Errorf("expected unknown compressed size, got %d", md.CompressedSize)
+	}
+}
@@ -0,0 +1,107 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Traced returns a FileSystem that reports every operation on fs to t, with
+// the path, duration and result of the operation. Files opened through it
+// report the number of bytes read when they are closed. If t is nil,
+// DefaultTracer is used.
+//
+// Traced can be used to trace a single mount of a Scope:
+//
+//	scope.Bind("/src", "/", vfs.Traced(fs, tracer), vfs.BindReplace)
+func Traced(fs FileSystem, t Tracer) FileSystem {
+	if t == nil {
+		t = DefaultTracer
+	}
+	return tracedFileSystem{fs, t}
+}
+
+type tracedFileSystem struct {
+	fs     FileSystem
+	tracer Tracer
+}
+
+func (fs tracedFileSystem) Open(name string) (ReadSeekCloser, error) {
+	return fs.OpenContext(context.Background(), name)
+}
+
+func (fs tracedFileSystem) OpenContext(ctx context.Context, name string) (ReadSeekCloser, error) {
+	start := time.Now()
+	f, err := OpenContext(ctx, fs.fs, name)
+	fs.tracer.Tracef(fs.fs, "Open(%q) = %v (%s)", name, err, time.Since(start))
+	if err != nil {
+		return nil, err
+	}
+	return &tracedFile{ReadSeekCloser: f, fs: fs, name: name, start: start}, nil
+}
+
+func (fs tracedFileSystem) Lstat(name string) (os.FileInfo, error) {
+	start := time.Now()
+	info, err := fs.fs.Lstat(name)
+	fs.tracer.Tracef(fs.fs, "Lstat(%q) = %v (%s)", name, err, time.Since(start))
+	return info, err
+}
+
+func (fs tracedFileSystem) Stat(name string) (os.FileInfo, error) {
+	return fs.StatContext(context.Background(), name)
+}
+
+func (fs tracedFileSystem) StatContext(ctx context.Context, name string) (os.FileInfo, error) {
+	start := time.Now()
+	info, err := StatContext(ctx, fs.fs, name)
+	fs.tracer.Tracef(fs.fs, "Stat(%q) = %v (%s)", name, err, time.Since(start))
+	return info, err
+}
+
+func (fs tracedFileSystem) Readdir(name string) ([]os.FileInfo, error) {
+	return fs.ReaddirContext(context.Background(), name)
+}
+
+func (fs tracedFileSystem) ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error) {
+	start := time.Now()
+	infos, err := ReaddirContext(ctx, fs.fs, name)
+	fs.tracer.Tracef(fs.fs, "Readdir(%q) = %d entries, %v (%s)", name, len(infos), err, time.Since(start))
+	return infos, err
+}
+
+func (fs tracedFileSystem) Readlink(name string) (string, error) {
+	start := time.Now()
+	target, err := Readlink(fs.fs, name)
+	fs.tracer.Tracef(fs.fs, "Readlink(%q) = %q, %v (%s)", name, target, err, time.Since(start))
+	return target, err
+}
+
+func (fs tracedFileSystem) String() string {
+	return fs.fs.String()
+}
+
+// tracedFile counts the bytes read from a file opened by a tracedFileSystem.
+type tracedFile struct {
+	ReadSeekCloser
+	fs    tracedFileSystem
+	name  string
+	start time.Time
+	read  int64
+}
+
+func (f *tracedFile) Read(p []byte) (int, error) {
+	n, err := f.ReadSeekCloser.Read(p)
+	f.read += int64(n)
+	return n, err
+}
+
+func (f *tracedFile) Close() error {
+	err := f.ReadSeekCloser.Close()
+	f.fs.tracer.Tracef(f.fs.fs, "Close(%q) = %v after reading %d bytes (%s)", f.name, err, f.read, time.Since(f.start))
+	return err
+}
+
+var (
+	_ ContextFileSystem  = tracedFileSystem{}
+	_ ReadlinkFileSystem = tracedFileSystem{}
+)
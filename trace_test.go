@@ -0,0 +1,78 @@
+package vfs_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+	"textmodes.com/vfs/zipfs"
+)
+
+// recorder is a Tracer recording all messages.
+type recorder []string
+
+func (r *recorder) Tracef(fs vfs.FileSystem, format string, v ...interface{}) {
+	*r = append(*r, fmt.Sprintf(format, v...))
+}
+
+func (r recorder) contains(s string) bool {
+	for _, msg := range r {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTraced(t *testing.T) {
+	var r recorder
+	fs := vfs.Traced(mapfs.New(map[string]string{"a": "abc"}), &r)
+
+	f, err := fs.Open("/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	fs.Stat("/missing")
+
+	for _, want := range []string{`Open("/a") = <nil>`, `Close("/a") = <nil> after reading 3 bytes`, `Stat("/missing") = stat /missing`} {
+		if !r.contains(want) {
+			t.Errorf("expected a message containing %q, got %q", want, r)
+		}
+	}
+}
+
+func TestSetTracer(t *testing.T) {
+	var global, local recorder
+	defer func(trace bool, tracer vfs.Tracer) {
+		vfs.Trace, vfs.DefaultTracer = trace, tracer
+	}(vfs.Trace, vfs.DefaultTracer)
+	vfs.Trace, vfs.DefaultTracer = true, &global
+
+	fs, err := zipfs.Open("testdata/zip/unix.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = vfs.SetTracer(fs, &local); err != nil {
+		t.Fatal(err)
+	}
+	global = nil
+
+	fs.Stat("/hello")
+	if !local.contains(`Stat("/hello")`) {
+		t.Errorf("expected a message for Stat, got %q", local)
+	}
+	if len(global) > 0 {
+		t.Errorf("expected no messages to the default tracer, got %q", global)
+	}
+
+	if err = vfs.SetTracer(mapfs.New(nil), &local); err == nil {
+		t.Error("expected an error setting the tracer of mapfs")
+	}
+}
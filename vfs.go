@@ -1,8 +1,10 @@
 package vfs // import "textmodes.com/vfs"
 
 import (
+	"context"
 	"io"
 	"os"
+	"time"
 )
 
 // FileSystem implement a (virtual) file system.
@@ -32,6 +34,93 @@ type Opener interface {
 	Open(name string) (ReadSeekCloser, error)
 }
 
+// WriteFileSystem is a FileSystem that can also modify its contents.
+// Implementations are optional; callers should type assert a FileSystem to
+// find out whether it supports writes. Scope and SyncScope always implement
+// it, and return ErrNotSupported for paths without a writable mount.
+type WriteFileSystem interface {
+	FileSystem
+
+	// Create creates or truncates the named file.
+	Create(name string) (ReadWriteSeekCloser, error)
+
+	// OpenFile opens the named file with the specified flag (os.O_RDONLY
+	// etc.) and perm, if the file is created.
+	OpenFile(name string, flag int, perm os.FileMode) (ReadWriteSeekCloser, error)
+
+	// Mkdir creates a new directory with the specified name and permission
+	// bits.
+	Mkdir(name string, perm os.FileMode) error
+
+	// MkdirAll creates a directory named path, along with any necessary
+	// parents.
+	MkdirAll(name string, perm os.FileMode) error
+
+	// Remove removes the named file or (empty) directory.
+	Remove(name string) error
+
+	// RemoveAll removes path and any children it contains.
+	RemoveAll(name string) error
+
+	// Rename renames (moves) oldname to newname.
+	Rename(oldname, newname string) error
+
+	// Chmod changes the mode of the named file to mode.
+	Chmod(name string, mode os.FileMode) error
+
+	// Chtimes changes the access and modification times of the named file.
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// ContextFileSystem is a FileSystem whose operations can be cancelled, for
+// example when scanning large archives. Implementations are optional; see
+// OpenContext, StatContext, ReaddirContext and WithContext for helpers that
+// fall back to the plain FileSystem methods.
+type ContextFileSystem interface {
+	FileSystem
+
+	// OpenContext is like Open, but aborts when ctx is done. The context
+	// also applies to reads from the returned file.
+	OpenContext(ctx context.Context, name string) (ReadSeekCloser, error)
+
+	// StatContext is like Stat, but aborts when ctx is done.
+	StatContext(ctx context.Context, name string) (os.FileInfo, error)
+
+	// ReaddirContext is like Readdir, but aborts when ctx is done.
+	ReaddirContext(ctx context.Context, name string) ([]os.FileInfo, error)
+}
+
+// ReadlinkFileSystem is a FileSystem that supports symbolic links. For these
+// file systems Stat follows links, while Lstat describes the link itself.
+type ReadlinkFileSystem interface {
+	FileSystem
+
+	// Readlink returns the destination of the named symbolic link, as it
+	// is stored in the file system.
+	Readlink(name string) (string, error)
+}
+
+// MountFileSystem is a FileSystem made of other file systems, such as a Scope
+// or autofs.
+type MountFileSystem interface {
+	FileSystem
+
+	// Locate returns the file system containing name and the path of name
+	// in it. It reports false if name doesn't exist.
+	Locate(name string) (fs FileSystem, base string, ok bool)
+}
+
+// HardLinkInfo is implemented by the os.FileInfo of a hard link in file systems
+// that record which entries share their contents, such as archives. Size and
+// contents of the link are those of its target.
+type HardLinkInfo interface {
+	os.FileInfo
+
+	// HardLink returns the absolute path of the file whose contents are
+	// shared by this one.
+	HardLink() string
+}
+
 // ReadSeekCloser can read, seek and close.
 type ReadSeekCloser interface {
 	io.Reader
@@ -39,6 +128,14 @@ type ReadSeekCloser interface {
 	io.Closer
 }
 
+// ReadWriteSeekCloser can read, write, seek and close.
+type ReadWriteSeekCloser interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
 // ReaderAt emulates io.ReaderAt on a ReadSeekCloser by using Seek() for each
 // call to ReadAt.
 func ReaderAt(rsc ReadSeekCloser) io.ReaderAt {
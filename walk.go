@@ -0,0 +1,253 @@
+package vfs
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// WalkMode determines how Walk and WalkDir treat symbolic links.
+type WalkMode int
+
+// Walk modes.
+const (
+	// WalkNoFollow reports symbolic links without following them.
+	WalkNoFollow WalkMode = iota
+
+	// WalkFollow follows symbolic links and descends into the directories
+	// they point to. Links pointing back into a directory that is being
+	// walked are reported with ErrSymlinkLoop instead, and links that can't
+	// be followed are reported with the error of Stat.
+	WalkFollow
+)
+
+// maxSymlinks is the maximum number of nested symbolic links WalkFollow will
+// traverse.
+const maxSymlinks = 40
+
+// Walk walks the file tree rooted at root, calling fn for each file or
+// directory in the tree, including root. It has the same semantics as
+// filepath.Walk: files are walked in lexical order, fn may return
+// filepath.SkipDir or filepath.SkipAll, and errors reading a directory are
+// passed to fn.
+//
+// By default symbolic links are not followed, see WalkMode.
+func Walk(fsys FileSystem, root string, fn filepath.WalkFunc, mode ...WalkMode) error {
+	w := newWalker(fsys, mode)
+	info, err := w.stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walk(root, info, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// WalkDir is like Walk, but has the same semantics as fs.WalkDir: fn is
+// called for a directory before it is read, and again if reading it fails.
+func WalkDir(fsys FileSystem, root string, fn fs.WalkDirFunc, mode ...WalkMode) error {
+	w := newWalker(fsys, mode)
+	info, err := w.stat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walkDir(root, info, fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+type walker struct {
+	fs        FileSystem
+	follow    bool
+	ancestors []ancestor
+	links     int
+}
+
+// ancestor is a directory being walked.
+type ancestor struct {
+	info os.FileInfo
+	loc  location
+}
+
+// location is a path in the file system containing it, with symbolic links
+// resolved.
+type location struct {
+	fs   FileSystem
+	path string
+}
+
+func newWalker(fsys FileSystem, mode []WalkMode) *walker {
+	return &walker{
+		fs:     fsys,
+		follow: len(mode) > 0 && mode[0] == WalkFollow,
+	}
+}
+
+func (w *walker) stat(name string) (os.FileInfo, error) {
+	if w.follow {
+		return w.fs.Stat(name)
+	}
+	return w.fs.Lstat(name)
+}
+
+// resolve returns the info to report for name. If name is a symbolic link
+// and links are followed, the target is returned and link is true.
+func (w *walker) resolve(name string, info os.FileInfo) (target os.FileInfo, link bool, err error) {
+	if !w.follow || info.Mode()&os.ModeSymlink == 0 {
+		return info, false, nil
+	}
+	if target, err = w.fs.Stat(name); err != nil {
+		// Dangling links are reported with the error.
+		return info, false, err
+	}
+	if !target.IsDir() {
+		return target, false, nil
+	}
+	if w.links >= maxSymlinks {
+		return target, true, &os.PathError{Op: "walk", Path: name, Err: ErrSymlinkLoop}
+	}
+
+	// Links are resolved in the file systems containing them, so loops are
+	// found across mount points and in archives, where os.SameFile doesn't
+	// work.
+	loc := w.locate(name)
+	for _, a := range w.ancestors {
+		if (sameFileSystem(a.loc.fs, loc.fs) && a.loc.path == loc.path) || os.SameFile(a.info, target) {
+			return target, true, &os.PathError{Op: "walk", Path: name, Err: ErrSymlinkLoop}
+		}
+	}
+	return target, true, nil
+}
+
+// locate returns the location of name, in the innermost file system
+// containing it.
+func (w *walker) locate(name string) location {
+	fs, name := w.fs, path.Clean("/"+name)
+	for i := 0; i < maxSymlinks; i++ {
+		mfs, ok := fs.(MountFileSystem)
+		if !ok {
+			break
+		}
+		inner, base, ok := mfs.Locate(name)
+		if !ok {
+			break
+		}
+		fs, name = inner, path.Clean("/"+base)
+	}
+	if rfs, ok := fs.(ReadlinkFileSystem); ok {
+		if resolved, err := EvalSymlinks(rfs, name); err == nil {
+			name = path.Clean("/" + resolved)
+		}
+	}
+	return location{fs, name}
+}
+
+// enter records that the walker descends into the directory name.
+func (w *walker) enter(name string, info os.FileInfo, link bool) {
+	var loc location
+	if w.follow {
+		loc = w.locate(name)
+	}
+	w.ancestors = append(w.ancestors, ancestor{info, loc})
+	if link {
+		w.links++
+	}
+}
+
+// leave undoes enter.
+func (w *walker) leave(link bool) {
+	w.ancestors = w.ancestors[:len(w.ancestors)-1]
+	if link {
+		w.links--
+	}
+}
+
+// readdir returns the directory entries of name in lexical order.
+func (w *walker) readdir(name string) ([]os.FileInfo, error) {
+	infos, err := w.fs.Readdir(name)
+	if err != nil {
+		return nil, err
+	}
+	infos = append([]os.FileInfo(nil), infos...)
+	sort.Sort(byName(infos))
+	return infos, nil
+}
+
+func (w *walker) walk(name string, info os.FileInfo, fn filepath.WalkFunc) error {
+	info, link, err := w.resolve(name, info)
+	if err != nil || !info.IsDir() {
+		if err = fn(name, info, err); err == filepath.SkipDir && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+
+	w.enter(name, info, link)
+	defer w.leave(link)
+
+	infos, err := w.readdir(name)
+	if err1 := fn(name, info, err); err != nil || err1 != nil {
+		if err1 == filepath.SkipDir {
+			return nil
+		}
+		return err1
+	}
+
+	for _, child := range infos {
+		if err = w.walk(path.Join(name, path.Base(child.Name())), child, fn); err != nil {
+			if err == filepath.SkipDir {
+				// Returned for a file; skip the remaining files.
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *walker) walkDir(name string, info os.FileInfo, fn fs.WalkDirFunc) error {
+	info, link, err := w.resolve(name, info)
+	d := fs.FileInfoToDirEntry(info)
+	if err != nil || !info.IsDir() {
+		if err = fn(name, d, err); err == fs.SkipDir && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+
+	if err = fn(name, d, nil); err != nil {
+		if err == fs.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	w.enter(name, info, link)
+	defer w.leave(link)
+
+	infos, err := w.readdir(name)
+	if err != nil {
+		if err = fn(name, d, err); err == fs.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	for _, child := range infos {
+		if err = w.walkDir(path.Join(name, path.Base(child.Name())), child, fn); err != nil {
+			if err == fs.SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package vfs_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"textmodes.com/vfs"
+	"textmodes.com/vfs/mapfs"
+	"textmodes.com/vfs/tarfs"
+)
+
+func testWalkScope() vfs.Scope {
+	scope := vfs.NewScope()
+	scope.Bind("/", "/", mapfs.New(map[string]string{
+		"b/2":   "2",
+		"b/1":   "1",
+		"a":     "a",
+		"c/d/e": "e",
+	}), vfs.BindReplace)
+	scope.Bind("/c/mnt", "/", mapfs.New(map[string]string{
+		"x": "x",
+	}), vfs.BindReplace)
+	return scope
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		skip string
+		want []string
+	}{
+		{"", []string{"/", "/a", "/b", "/b/1", "/b/2", "/c", "/c/d", "/c/d/e", "/c/mnt", "/c/mnt/x"}},
+		{"/b", []string{"/", "/a", "/b", "/c", "/c/d", "/c/d/e", "/c/mnt", "/c/mnt/x"}},
+		{"/b/1", []string{"/", "/a", "/b", "/b/1", "/c", "/c/d", "/c/d/e", "/c/mnt", "/c/mnt/x"}},
+	}
+	for _, test := range tests {
+		var got []string
+		err := vfs.Walk(testWalkScope(), "/", func(name string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			got = append(got, name)
+			if name == test.skip {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Walk (skip %q): %v", test.skip, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Walk (skip %q): expected %q, got %q", test.skip, test.want, got)
+		}
+	}
+}
+
+func TestWalkDirSkipAll(t *testing.T) {
+	var got []string
+	err := vfs.WalkDir(testWalkScope(), "/", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, name)
+		if name == "/b/1" {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir: %v", err)
+	}
+	if want := []string{"/", "/a", "/b", "/b/1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestWalkError(t *testing.T) {
+	want := errors.New("stop")
+	err := vfs.Walk(testWalkScope(), "/missing", func(name string, info os.FileInfo, err error) error {
+		if !os.IsNotExist(err) {
+			t.Errorf("expected a not exist error for %s, got %v", name, err)
+		}
+		return want
+	})
+	if err != want {
+		t.Errorf("expected %v, got %v", want, err)
+	}
+}
+
+func TestWalkFollowLoop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = os.MkdirAll(filepath.Join(dir, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink("..", filepath.Join(dir, "a", "b", "up")); err != nil {
+		t.Skip(err)
+	}
+
+	for _, mode := range []vfs.WalkMode{vfs.WalkNoFollow, vfs.WalkFollow} {
+		var (
+			got   []string
+			loops int
+		)
+		err = vfs.Walk(vfs.OS(dir), "/", func(name string, info os.FileInfo, err error) error {
+			if errors.Is(err, vfs.ErrSymlinkLoop) {
+				loops++
+				return nil
+			} else if err != nil {
+				return err
+			}
+			got = append(got, name)
+			return nil
+		}, mode)
+		if err != nil {
+			t.Fatalf("Walk (mode %d): %v", mode, err)
+		}
+		want := []string{"/", "/a", "/a/b", "/a/b/up"}
+		if mode == vfs.WalkFollow {
+			want = want[:3]
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Walk (mode %d): expected %q, got %q", mode, want, got)
+		}
+		if want := 0; mode == vfs.WalkNoFollow && loops != want {
+			t.Errorf("Walk (mode %d): expected %d loops, got %d", mode, want, loops)
+		}
+		if want := 1; mode == vfs.WalkFollow && loops != want {
+			t.Errorf("Walk (mode %d): expected %d loops, got %d", mode, want, loops)
+		}
+	}
+}
+
+func TestWalkFollowArchive(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range []*tar.Header{
+		{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "a/b/up", Typeflag: tar.TypeSymlink, Linkname: "/a"},
+		{Name: "a/b/root", Typeflag: tar.TypeSymlink, Linkname: "/"},
+		{Name: "a/dangling", Typeflag: tar.TypeSymlink, Linkname: "/missing"},
+	} {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := tarfs.OpenFile(mapfs.New(map[string]string{"a.tar": buf.String()}), "/a.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loops are found through the mount point of the archive.
+	scope := vfs.NewScope()
+	scope.Bind("/mnt", "/", archive, vfs.BindReplace)
+
+	var (
+		got             []string
+		loops, dangling int
+	)
+	err = vfs.Walk(scope, "/", func(name string, info os.FileInfo, err error) error {
+		switch {
+		case errors.Is(err, vfs.ErrSymlinkLoop):
+			loops++
+		case errors.Is(err, os.ErrNotExist) && name == "/mnt/a/dangling":
+			dangling++
+		case err != nil:
+			return err
+		default:
+			got = append(got, name)
+		}
+		return nil
+	}, vfs.WalkFollow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/", "/mnt", "/mnt/a", "/mnt/a/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if loops != 2 {
+		t.Errorf("expected 2 loops, got %d", loops)
+	}
+	if dangling != 1 {
+		t.Errorf("expected 1 dangling link, got %d", dangling)
+	}
+}
@@ -2,14 +2,19 @@ package zipfs
 
 import (
 	"archive/zip"
+	"encoding/binary"
+	"fmt"
 	"os"
 	"time"
+
+	"textmodes.com/vfs"
 )
 
 // fileInfo is the zip-file based implementation of FileInfo
 type fileInfo struct {
-	name string          // directory-local name
-	file *zip.FileHeader // nil for a directory
+	name    string          // directory-local name
+	file    *zip.FileHeader // nil for a directory
+	archive string          // name of the containing archive
 }
 
 func (fi fileInfo) Name() string {
@@ -35,7 +40,9 @@ func (fi fileInfo) Mode() os.FileMode {
 		// Unix directories typically are executable, hence 555.
 		return os.ModeDir | 0555
 	}
-	return 0444
+	// Return original file mode without writable bits, since we're a read
+	// only file system.
+	return fi.file.Mode() & ^os.FileMode(0222)
 }
 
 func (fi fileInfo) IsDir() bool {
@@ -43,5 +50,34 @@ func (fi fileInfo) IsDir() bool {
 }
 
 func (fi fileInfo) Sys() interface{} {
-	return nil
+	return fi.file
+}
+
+func (fi fileInfo) Metadata() vfs.Metadata {
+	md := vfs.Metadata{
+		Uid:     -1,
+		Gid:     -1,
+		Archive: fi.archive,
+	}
+	if f := fi.file; f != nil {
+		md.CompressedSize = int64(f.CompressedSize64)
+		md.Method = methodName(f.Method)
+		md.Checksum = make([]byte, 4)
+		binary.BigEndian.PutUint32(md.Checksum, f.CRC32)
+		md.ChecksumType = "crc32"
+		md.Comment = f.Comment
+	}
+	return md
+}
+
+// methodName returns the name of a zip compression method.
+func methodName(method uint16) string {
+	switch method {
+	case zip.Store:
+		return "store"
+	case zip.Deflate:
+		return "deflate"
+	default:
+		return fmt.Sprintf("method %d", method)
+	}
 }
@@ -5,13 +5,15 @@ package zipfs
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
 	"path"
 	"sort"
 	"strings"
+	"sync"
 
 	"textmodes.com/vfs"
 )
@@ -43,25 +45,71 @@ func (rsc emulatedFile) ReadAt(p []byte, off int64) (n int, err error) {
 	if _, err = rsc.Seek(off, io.SeekStart); err != nil {
 		return
 	}
-	return rsc.Read(p)
+	// Unlike Read, ReadAt must not return short reads without an error.
+	if n, err = io.ReadFull(rsc, p); err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return
+}
+
+// trackedFile is a fileLike registered with vfs.TrackHandle.
+type trackedFile struct {
+	fileLike
+	closed func()
+}
+
+func (f trackedFile) Close() error {
+	f.closed()
+	return f.fileLike.Close()
+}
+
+// contextFile is a fileLike that fails all reads once ctx is done.
+type contextFile struct {
+	fileLike
+	ctx context.Context
+}
+
+func (f contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.fileLike.Read(p)
+}
+
+func (f contextFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.fileLike.ReadAt(p, off)
 }
 
 // Open a name file on disk as FileSystem.
 func Open(name string) (vfs.FileSystem, error) {
-	return open(name, func() (fileLike, error) {
+	return OpenContext(context.Background(), name)
+}
+
+// OpenContext is like Open, but stops reading the archive when ctx is done.
+func OpenContext(ctx context.Context, name string) (vfs.FileSystem, error) {
+	return open(ctx, name, func(context.Context) (fileLike, error) {
 		return os.Open(name)
 	})
 }
 
 // OpenFile opens a file on a FileSystem as FileSystem.
 func OpenFile(fs vfs.FileSystem, name string) (vfs.FileSystem, error) {
+	return OpenFileContext(context.Background(), fs, name)
+}
+
+// OpenFileContext is like OpenFile, but stops reading the archive when ctx is
+// done.
+func OpenFileContext(ctx context.Context, fs vfs.FileSystem, name string) (vfs.FileSystem, error) {
 	vfs.Tracef(fs, "OpenFile(%q)", name)
-	return open(name, func() (fileLike, error) {
-		i, err := fs.Stat(name)
+	return open(ctx, name, func(ctx context.Context) (fileLike, error) {
+		i, err := vfs.StatContext(ctx, fs, name)
 		if err != nil {
 			return nil, err
 		}
-		f, err := fs.Open(name)
+		f, err := vfs.OpenContext(ctx, fs, name)
 		if err != nil {
 			return nil, err
 		}
@@ -69,8 +117,8 @@ func OpenFile(fs vfs.FileSystem, name string) (vfs.FileSystem, error) {
 	})
 }
 
-func open(name string, open func() (fileLike, error)) (vfs.FileSystem, error) {
-	z, err := openReadCloser(open)
+func open(ctx context.Context, name string, open func(context.Context) (fileLike, error)) (vfs.FileSystem, error) {
+	z, err := openReadCloser(ctx, open)
 	if err != nil {
 		return nil, err
 	}
@@ -83,6 +131,11 @@ func open(name string, open func() (fileLike, error)) (vfs.FileSystem, error) {
 	}
 	for i, file := range z.File {
 		fs.list[i] = &file.FileHeader
+		if file.Mode()&os.ModeSymlink != 0 {
+			if err = fs.readLink(file); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	sort.SliceStable(fs.list, func(i, j int) bool {
@@ -96,16 +149,40 @@ func open(name string, open func() (fileLike, error)) (vfs.FileSystem, error) {
 	return fs, nil
 }
 
+// readLink records the destination of the symbolic link file, which zip
+// stores as the contents of the entry.
+func (fs *fileSystem) readLink(file *zip.File) error {
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if fs.links == nil {
+		fs.links = make(map[string]string)
+	}
+	fs.links[file.Name] = string(b)
+	return nil
+}
+
 type readCloser struct {
 	*zip.Reader
 	io.Closer
 }
 
-func openReadCloser(open func() (fileLike, error)) (*readCloser, error) {
-	f, err := open()
+func openReadCloser(ctx context.Context, open func(context.Context) (fileLike, error)) (*readCloser, error) {
+	f, err := open(ctx)
 	if err != nil {
 		return nil, err
 	}
+	f = trackedFile{f, vfs.TrackHandle(f.Name())}
+	if ctx.Done() != nil {
+		f = contextFile{f, ctx}
+	}
 
 	i, err := f.Stat()
 	if err != nil {
@@ -113,67 +190,76 @@ func openReadCloser(open func() (fileLike, error)) (*readCloser, error) {
 		return nil, err
 	}
 
-	log.Printf("info: %#+v (%T)", i, i)
+	vfs.Tracef(nil, "zip.NewReader(%q, %d)", f.Name(), i.Size())
 
 	z, err := zip.NewReader(f, i.Size())
 	if err != nil {
 		f.Close()
-		switch err {
-		case zip.ErrAlgorithm:
-			return nil, vfs.ErrNotSupported
-		case zip.ErrFormat:
-			return nil, vfs.ErrNotSupported
-		default:
-			return nil, err
-		}
+		return nil, &os.PathError{Op: "open", Path: f.Name(), Err: zipError(err)}
 	}
 
 	return &readCloser{z, f}, nil
 }
 
+// zipError maps the errors of archive/zip to their vfs equivalent.
+func zipError(err error) error {
+	switch err {
+	case zip.ErrAlgorithm:
+		return fmt.Errorf("%w: %v", vfs.ErrNotSupported, err)
+	case zip.ErrFormat, zip.ErrChecksum:
+		return fmt.Errorf("%w: %v", vfs.ErrCorrupt, err)
+	default:
+		return err
+	}
+}
+
 type fileSystem struct {
-	name string
-	list []*zip.FileHeader
-	open func() (fileLike, error)
+	name   string
+	list   []*zip.FileHeader
+	links  map[string]string
+	open   func(context.Context) (fileLike, error)
+	mu     sync.Mutex // guards tracer
+	tracer vfs.Tracer
 }
 
 // lookup returns the smallest index of an entry with an exact match
 // for name, or an inexact match starting with name/. If there is no
 // such entry, the result is -1, false.
-func (fs fileSystem) lookup(name string) (index int, exact bool) {
+func (fs *fileSystem) lookup(name string) (index int, exact bool) {
+	list := fs.list
 	// look for exact match first (name comes before name/ in z)
-	i := sort.Search(len(fs.list), func(i int) bool {
-		return name <= fs.list[i].Name
+	i := sort.Search(len(list), func(i int) bool {
+		return name <= list[i].Name
 	})
-	if i >= len(fs.list) {
+	if i >= len(list) {
 		return -1, false
 	}
 	// 0 <= i < len(z)
-	if fs.list[i].Name == name {
+	if list[i].Name == name {
 		return i, true
 	}
 
 	// look for inexact match (must be in z[i:], if present)
-	fs.list = fs.list[i:]
+	list = list[i:]
 	name += "/"
-	j := sort.Search(len(fs.list), func(i int) bool {
-		return name <= fs.list[i].Name
+	j := sort.Search(len(list), func(i int) bool {
+		return name <= list[i].Name
 	})
-	if j >= len(fs.list) {
+	if j >= len(list) {
 		return -1, false
 	}
 	// 0 <= j < len(z)
-	if strings.HasPrefix(fs.list[j].Name, name) {
+	if strings.HasPrefix(list[j].Name, name) {
 		return i + j, false
 	}
 
 	return -1, false
 }
 
-func zipPath(name string) (string, error) {
+func zipPath(op, name string) (string, error) {
 	name = path.Clean(name)
 	if !path.IsAbs(name) {
-		return "", fmt.Errorf("stat: not an absolute path: %s", name)
+		return "", &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
 	}
 	return name[1:], nil // strip leading '/'
 }
@@ -182,112 +268,216 @@ func isRoot(abspath string) bool {
 	return path.Clean(abspath) == "/"
 }
 
-func (fs *fileSystem) stat(abspath string) (int, fileInfo, error) {
+func (fs *fileSystem) stat(op, abspath string) (int, fileInfo, error) {
 	vfs.Tracef(fs, "stat(%q)", abspath)
 	if isRoot(abspath) {
 		return 0, fileInfo{
-			name: "",
-			file: nil,
+			name:    "",
+			file:    nil,
+			archive: fs.name,
 		}, nil
 	}
-	zippath, err := zipPath(abspath)
+	zippath, err := zipPath(op, abspath)
 	if err != nil {
 		return 0, fileInfo{}, err
 	}
 	i, exact := fs.lookup(zippath)
 	if i < 0 {
 		// zippath has leading '/' stripped - print it explicitly
-		return -1, fileInfo{}, &os.PathError{Path: "/" + zippath, Err: os.ErrNotExist}
+		return -1, fileInfo{}, &os.PathError{Op: op, Path: "/" + zippath, Err: os.ErrNotExist}
 	}
 	_, name := path.Split(zippath)
 	var file *zip.FileHeader
 	if exact {
 		file = fs.list[i] // exact match found - must be a file
 	}
-	return i, fileInfo{name, file}, nil
+	return i, fileInfo{name, file, fs.name}, nil
 }
 
 func (fs *fileSystem) Lstat(abspath string) (os.FileInfo, error) {
 	vfs.Tracef(fs, "Lstat(%q)", abspath)
-	_, fi, err := fs.stat(abspath)
+	_, fi, err := fs.stat("lstat", abspath)
 	return fi, err
 }
 
 func (fs *fileSystem) Stat(abspath string) (os.FileInfo, error) {
 	vfs.Tracef(fs, "Stat(%q)", abspath)
-	_, fi, err := fs.stat(abspath)
+	target, err := fs.follow(abspath)
+	if err != nil {
+		return nil, err
+	}
+	_, fi, err := fs.stat("stat", target)
+	if err == nil && path.Clean(target) != path.Clean(abspath) {
+		fi.name = path.Base(abspath)
+	}
 	return fi, err
 }
 
+func (fs *fileSystem) Readlink(abspath string) (string, error) {
+	vfs.Tracef(fs, "Readlink(%q)", abspath)
+	_, fi, err := fs.stat("readlink", abspath)
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: abspath, Err: os.ErrInvalid}
+	}
+	return fs.links[fi.file.Name], nil
+}
+
+// follow returns abspath with all symbolic links resolved.
+func (fs *fileSystem) follow(abspath string) (string, error) {
+	if len(fs.links) == 0 {
+		return abspath, nil
+	}
+	return vfs.EvalSymlinks(fs, abspath)
+}
+
+// emulatedRSC emulates io.Seeker for a compressed entry by reopening the
+// entry and skipping ahead to the requested offset.
 type emulatedRSC struct {
+	io.Reader
 	io.Closer
-	io.ReadCloser
-	name string
-	open func() (fileLike, error)
+	name   string // full path of the entry, for errors
+	size   int64
+	offset int64
+	open   func() (io.Reader, io.Closer, error)
 }
 
-func (rsc emulatedRSC) Close() error {
-	err1 := rsc.ReadCloser.Close()
-	err2 := rsc.Closer.Close()
+func (rsc *emulatedRSC) Read(p []byte) (n int, err error) {
+	n, err = rsc.Reader.Read(p)
+	rsc.offset += int64(n)
+	return
+}
+
+func (rsc *emulatedRSC) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rsc.offset
+	case io.SeekEnd:
+		offset += rsc.size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: rsc.name, Err: os.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: rsc.name, Err: os.ErrInvalid}
+	}
+
+	if offset < rsc.offset {
+		r, c, err := rsc.open()
+		if err != nil {
+			return 0, err
+		}
+		rsc.Closer.Close()
+		rsc.Reader, rsc.Closer, rsc.offset = r, c, 0
+	}
+	if _, err := io.CopyN(ioutil.Discard, rsc, offset-rsc.offset); err != nil && err != io.EOF {
+		return 0, err
+	}
+	rsc.offset = offset
+	return offset, nil
+}
+
+// entryCloser closes an archive entry and the archive containing it.
+type entryCloser struct {
+	entry   io.Closer
+	archive io.Closer
+}
+
+func (c entryCloser) Close() error {
+	err1 := c.entry.Close()
+	err2 := c.archive.Close()
 	if err1 != nil {
 		return err1
 	}
 	return err2
 }
 
-func (rsc emulatedRSC) Seek(offset int64, whence int) (int64, error) {
-	if whence == 0 && offset == 0 {
-		r, err := rsc.open()
-		if err != nil {
-			return 0, err
+// openEntry opens the archive and returns a reader for the named entry.
+func (fs *fileSystem) openEntry(ctx context.Context, name string) (io.Reader, io.Closer, error) {
+	z, err := openReadCloser(ctx, fs.open)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, file := range z.File {
+		if file.Name == name {
+			r, err := file.Open()
+			if err != nil {
+				z.Close()
+				return nil, nil, &os.PathError{Op: "open", Path: "/" + name, Err: zipError(err)}
+			}
+			return r, entryCloser{r, z}, nil
 		}
-		rsc.ReadCloser.Close()
-		rsc.ReadCloser = r
-		return 0, nil
 	}
-	return 0, fmt.Errorf("unsupported Seek in %s", rsc.name)
+
+	z.Close()
+	return nil, nil, &os.PathError{Op: "open", Path: "/" + name, Err: os.ErrNotExist}
 }
 
 func (fs *fileSystem) Open(abspath string) (vfs.ReadSeekCloser, error) {
-	_, fi, err := fs.stat(abspath)
+	return fs.OpenContext(context.Background(), abspath)
+}
+
+func (fs *fileSystem) OpenContext(ctx context.Context, abspath string) (vfs.ReadSeekCloser, error) {
+	abspath, err := fs.follow(abspath)
+	if err != nil {
+		return nil, err
+	}
+	_, fi, err := fs.stat("open", abspath)
 	if err != nil {
 		return nil, err
 	}
 	if fi.IsDir() {
-		return nil, fmt.Errorf("zipfs: %s is a directory", abspath)
+		return nil, &os.PathError{Op: "open", Path: path.Clean("/" + abspath), Err: vfs.ErrIsDir}
+	}
+	if fi.file.Flags&0x1 != 0 {
+		// Encrypted entries are not supported by archive/zip.
+		return nil, &os.PathError{Op: "open", Path: path.Clean("/" + abspath), Err: vfs.ErrEncrypted}
 	}
 
-	z, err := openReadCloser(fs.open)
+	name := fi.file.Name
+	r, c, err := fs.openEntry(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	defer z.Close()
+	return &emulatedRSC{
+		Reader: r,
+		Closer: c,
+		name:   path.Clean("/" + abspath),
+		size:   fi.Size(),
+		open: func() (io.Reader, io.Closer, error) {
+			return fs.openEntry(ctx, name)
+		},
+	}, nil
+}
 
-	for _, file := range z.File {
-		if file.Name == fi.file.Name {
-			f, err := file.Open()
-			if err != nil {
-				return nil, err
-			}
-			return emulatedRSC{
-				ReadCloser: f,
-				Closer:     z,
-				name:       file.Name,
-				open:       fs.open,
-			}, nil
-		}
+func (fs *fileSystem) StatContext(ctx context.Context, abspath string) (os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+	return fs.Stat(abspath)
+}
 
-	panic("unreachable")
+func (fs *fileSystem) ReaddirContext(ctx context.Context, abspath string) ([]os.FileInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return fs.Readdir(abspath)
 }
 
 func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
-	i, fi, err := fs.stat(abspath)
+	abspath, err := fs.follow(abspath)
+	if err != nil {
+		return nil, err
+	}
+	i, fi, err := fs.stat("readdir", abspath)
 	if err != nil {
 		return nil, err
 	}
 	if !fi.IsDir() {
-		return nil, fmt.Errorf("zipfs: %s is not a directory", abspath)
+		return nil, &os.PathError{Op: "readdir", Path: path.Clean("/" + abspath), Err: vfs.ErrNotDir}
 	}
 
 	var list []os.FileInfo
@@ -300,7 +490,7 @@ func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 	if isRoot(abspath) {
 		dirname = ""
 	} else {
-		zippath, err := zipPath(abspath)
+		zippath, err := zipPath("readdir", abspath)
 		if err != nil {
 			return nil, err
 		}
@@ -324,7 +514,7 @@ func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 		// by determining the (fs.list) range of local directory entries
 		// (via two binary searches).
 		if name != prevname {
-			list = append(list, fileInfo{name, file})
+			list = append(list, fileInfo{name, file, fs.name})
 			prevname = name
 		}
 	}
@@ -332,6 +522,27 @@ func (fs *fileSystem) Readdir(abspath string) ([]os.FileInfo, error) {
 	return list, nil
 }
 
+// Tracer returns the Tracer set with SetTracer.
+func (fs *fileSystem) Tracer() vfs.Tracer {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.tracer
+}
+
+// SetTracer sets the Tracer for the operations on the archive.
+func (fs *fileSystem) SetTracer(t vfs.Tracer) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.tracer = t
+}
+
 func (fs *fileSystem) String() string {
 	return fmt.Sprintf(`zipfs(%s)`, fs.name)
 }
+
+var (
+	_ vfs.ContextFileSystem  = (*fileSystem)(nil)
+	_ vfs.MetadataInfo       = fileInfo{}
+	_ vfs.ReadlinkFileSystem = (*fileSystem)(nil)
+	_ vfs.TracerFileSystem   = (*fileSystem)(nil)
+)
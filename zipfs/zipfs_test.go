@@ -3,6 +3,8 @@ package zipfs
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -102,7 +104,7 @@ func setup() error {
 		}
 		fs = New(zr, "foo")
 	*/
-	opener := func() (fileLike, error) {
+	opener := func(context.Context) (fileLike, error) {
 		rsc := &testNullCloser{
 			ReadSeeker: bytes.NewReader(b.Bytes()),
 			name:       "test.zip",
@@ -114,7 +116,7 @@ func setup() error {
 			name:           "test.zip",
 		}, nil
 	}
-	fs, _ = open("test.zip", opener)
+	fs, _ = open(context.Background(), "test.zip", opener)
 
 	// pull out different stat functions
 	statFuncs = []statFunc{
@@ -293,3 +295,61 @@ func testRecursive(t *testing.T, fs vfs.FileSystem, dir string) {
 		}
 	}
 }
+
+func TestSymlink(t *testing.T) {
+	fs, err := Open("../testdata/zip/symlink.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := fs.Lstat("/symlink")
+	if err != nil {
+		t.Fatalf("Lstat: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected Lstat(%q) to return a symlink, got mode %s", "/symlink", info.Mode())
+	}
+
+	target, err := vfs.Readlink(fs, "/symlink")
+	if err != nil {
+		t.Fatalf("Readlink: %v", err)
+	}
+	if want := "../target"; target != want {
+		t.Errorf("expected Readlink to return %q, got %q", want, target)
+	}
+
+	if _, err = fs.Stat("/symlink"); !os.IsNotExist(err) {
+		t.Errorf("expected Stat of a dangling link to fail with a not exist error, got %v", err)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	info, err := fs.Stat("/bar/baz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := vfs.MetadataOf(info)
+	if want := "test.zip"; md.Archive != want {
+		t.Errorf("expected archive %q, got %q", want, md.Archive)
+	}
+	if want := "deflate"; md.Method != want {
+		t.Errorf("expected method %q, got %q", want, md.Method)
+	}
+	if want := []byte{0x78, 0x24, 0x04, 0x98}; md.ChecksumType != "crc32" || !bytes.Equal(md.Checksum, want) {
+		t.Errorf("expected crc32 %x, got %s %x", want, md.ChecksumType, md.Checksum)
+	}
+	if md.Uid != -1 || md.Gid != -1 {
+		t.Errorf("expected unknown owner, got %d:%d", md.Uid, md.Gid)
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	fs, err := Open("../testdata/tar/test_option_passphrase.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fs.Open("/file1"); !errors.Is(err, vfs.ErrEncrypted) {
+		t.Errorf("expected %v, got %v", vfs.ErrEncrypted, err)
+	}
+}